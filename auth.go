@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// minTokenSecret is the minimum length of the secret tokens are signed with.
+const minTokenSecret = 32
+
+const tokenHelp = `Issue an access token for a researcher.
+
+The token is signed with the secret in the -token-secret file and is valid
+until -ttl has passed. Researchers enter it on the index page, which sends it
+as the second websocket subprotocol after "contained.af". Scripts can send it
+the same way or in an "Authorization: Bearer" header; the token query
+parameter is only a fallback, as it ends up in access logs.`
+
+// researcherID is the format of researcher IDs, they end up in container
+// labels and logs.
+var researcherID = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.@-]{0,63}$`)
+
+// tokenClaims is the signed payload of an access token.
+type tokenClaims struct {
+	Researcher string `json:"researcher"`
+	Expires    int64  `json:"expires"`
+}
+
+// loadTokenSecret reads the secret tokens are signed with from file.
+func loadTokenSecret(file string) ([]byte, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("reading token secret: %v", err)
+	}
+	b = bytes.TrimSpace(b)
+	if len(b) < minTokenSecret {
+		return nil, fmt.Errorf("token secret in %s must be at least %d bytes long", file, minTokenSecret)
+	}
+	return b, nil
+}
+
+// issueToken returns a token for researcher valid until expires, signed with
+// secret. Tokens are the base64 encoded JSON claims and their HMAC-SHA256,
+// separated by a dot.
+func issueToken(secret []byte, researcher string, expires time.Time) (string, error) {
+	if !researcherID.MatchString(researcher) {
+		return "", fmt.Errorf("researcher ID %q must match %s", researcher, researcherID)
+	}
+	claims, err := json.Marshal(tokenClaims{
+		Researcher: researcher,
+		Expires:    expires.Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(claims)
+	return payload + "." + base64.RawURLEncoding.EncodeToString(signToken(secret, payload)), nil
+}
+
+func signToken(secret []byte, payload string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+// verifyToken checks the signature and expiry of token and returns the ID of
+// the researcher it was issued for.
+func verifyToken(secret []byte, token string, now time.Time) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return "", errors.New("malformed token")
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", errors.New("malformed token signature")
+	}
+	if !hmac.Equal(sig, signToken(secret, parts[0])) {
+		return "", errors.New("invalid token signature")
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return "", errors.New("malformed token claims")
+	}
+	var claims tokenClaims
+	if err := json.Unmarshal(b, &claims); err != nil {
+		return "", fmt.Errorf("malformed token claims: %v", err)
+	}
+	if !researcherID.MatchString(claims.Researcher) {
+		return "", fmt.Errorf("invalid researcher ID %q in token", claims.Researcher)
+	}
+	if now.Unix() >= claims.Expires {
+		return "", fmt.Errorf("token expired at %s", time.Unix(claims.Expires, 0).UTC().Format(time.RFC3339))
+	}
+	return claims.Researcher, nil
+}
+
+// tokenProtocol is the websocket subprotocol browsers offer along with their
+// access token, as they cannot set headers on websockets. It keeps the token
+// out of URLs, and so out of access logs and the browser history.
+const tokenProtocol = "contained.af"
+
+// requestToken returns the access token sent with r, from the websocket
+// subprotocols, the Authorization header or the token query parameter, in
+// that order.
+func requestToken(r *http.Request) string {
+	protocols := websocket.Subprotocols(r)
+	if len(protocols) == 2 && protocols[0] == tokenProtocol {
+		return protocols[1]
+	}
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+	// a fallback for clients that can set neither, the token ends up in
+	// access logs
+	return r.URL.Query().Get("token")
+}
+
+// authenticate returns the ID of the researcher making the request r, from
+// its client certificate or its access token. It returns an empty ID when
+// authentication is disabled.
+func (h *handler) authenticate(r *http.Request) (string, error) {
+	if researcher, ok, err := certResearcher(r); ok {
+		return researcher, err
+	}
+	if h.tokenSecret == nil {
+		return "", nil
+	}
+	token := requestToken(r)
+	if token == "" {
+		return "", errors.New("missing access token")
+	}
+	return verifyToken(h.tokenSecret, token, time.Now())
+}
+
+// requireAuth wraps next so it is only served to authenticated researchers.
+func (h *handler) requireAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, err := h.authenticate(r); err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// parseReviewers parses the comma separated IDs of the researchers allowed to
+// review the sessions of the others.
+func parseReviewers(list string) (map[string]bool, error) {
+	reviewers := map[string]bool{}
+	for _, id := range strings.Split(list, ",") {
+		id = strings.TrimSpace(id)
+		if id == "" {
+			continue
+		}
+		if !researcherID.MatchString(id) {
+			return nil, fmt.Errorf("reviewer ID %q must match %s", id, researcherID)
+		}
+		reviewers[id] = true
+	}
+	return reviewers, nil
+}
+
+// mayReview returns whether researcher may watch the sessions of owner. Nobody
+// may when authentication is disabled, as anyone knowing a session ID could.
+func (h *handler) mayReview(researcher, owner string) bool {
+	if researcher == "" {
+		return false
+	}
+	return researcher == owner || h.reviewers[researcher]
+}
+
+type tokenCommand struct {
+	ttl time.Duration
+}
+
+func (cmd *tokenCommand) Name() string      { return "token" }
+func (cmd *tokenCommand) Args() string      { return "[OPTIONS] <researcher>" }
+func (cmd *tokenCommand) ShortHelp() string { return "Issue an access token for a researcher" }
+func (cmd *tokenCommand) LongHelp() string  { return tokenHelp }
+func (cmd *tokenCommand) Hidden() bool      { return false }
+
+func (cmd *tokenCommand) Register(fs *flag.FlagSet) {
+	fs.DurationVar(&cmd.ttl, "ttl", 7*24*time.Hour, "how long the token is valid")
+}
+
+func (cmd *tokenCommand) Run(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return errors.New("must pass the ID of the researcher")
+	}
+	if tokenSecretFile == "" {
+		return errors.New("must pass the -token-secret file to sign the token with")
+	}
+	if cmd.ttl <= 0 {
+		return fmt.Errorf("ttl must be positive, given: %s", cmd.ttl)
+	}
+
+	secret, err := loadTokenSecret(tokenSecretFile)
+	if err != nil {
+		return err
+	}
+	token, err := issueToken(secret, args[0], time.Now().Add(cmd.ttl))
+	if err != nil {
+		return err
+	}
+	fmt.Println(token)
+	return nil
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/jsonmessage"
+	"github.com/docker/docker/pkg/term"
+)
+
+// backend runs the containers of the sessions. dockerBackend runs them on a
+// docker daemon, the tests use an in-memory fake.
+type backend interface {
+	// Pull makes sure image is present, pulling it if needed.
+	Pull(ctx context.Context, image string) error
+	// Create creates a container and returns its ID.
+	Create(ctx context.Context, cfg *container.Config, hostCfg *container.HostConfig) (string, error)
+	// Attach returns a connection to the stdin and tty of a container.
+	Attach(ctx context.Context, id string) (io.ReadWriteCloser, error)
+	Start(ctx context.Context, id string) error
+	Resize(ctx context.Context, id string, height, width uint) error
+	// Exec runs cmd as user with a tty in a running container. It returns
+	// the ID of the exec and a connection to its stdin and tty.
+	Exec(ctx context.Context, id, user string, cmd []string) (string, io.ReadWriteCloser, error)
+	ExecResize(ctx context.Context, execID string, height, width uint) error
+	// Remove removes a container and its volumes, killing it if it runs.
+	Remove(ctx context.Context, id string) error
+	Inspect(ctx context.Context, id string) (types.ContainerJSON, error)
+	// List returns all the containers carrying label.
+	List(ctx context.Context, label string) ([]types.Container, error)
+	Info(ctx context.Context) (types.Info, error)
+	// Negotiate agrees on an API version with the daemon and returns it.
+	Negotiate(ctx context.Context) (string, error)
+	// APIVersion returns the API version in use.
+	APIVersion() string
+}
+
+// dockerBackend is a backend running containers on a docker daemon.
+type dockerBackend struct {
+	cli *client.Client
+}
+
+func (d *dockerBackend) Pull(ctx context.Context, image string) error {
+	_, _, err := d.cli.ImageInspectWithRaw(ctx, image)
+	if err == nil {
+		return nil
+	}
+	if !client.IsErrNotFound(err) {
+		return err
+	}
+
+	resp, err := d.cli.ImagePull(ctx, image, types.ImagePullOptions{})
+	if err != nil {
+		return err
+	}
+	defer resp.Close()
+
+	fd, isTerm := term.GetFdInfo(os.Stdout)
+
+	return jsonmessage.DisplayJSONMessagesStream(resp, os.Stdout, fd, isTerm, nil)
+}
+
+func (d *dockerBackend) Create(ctx context.Context, cfg *container.Config, hostCfg *container.HostConfig) (string, error) {
+	r, err := d.cli.ContainerCreate(ctx, cfg, hostCfg, nil, "")
+	if err != nil {
+		return "", err
+	}
+	return r.ID, nil
+}
+
+func (d *dockerBackend) Attach(ctx context.Context, id string) (io.ReadWriteCloser, error) {
+	r, err := d.cli.ContainerAttach(ctx, id, types.ContainerAttachOptions{
+		Stream: true,
+		Stdin:  true,
+		Stdout: true,
+		Stderr: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return hijackedConn{r}, nil
+}
+
+// hijackedConn reads from the buffered reader of a hijacked connection, which
+// may hold data read past the HTTP response, and writes to the connection.
+type hijackedConn struct {
+	types.HijackedResponse
+}
+
+func (c hijackedConn) Read(p []byte) (int, error)  { return c.Reader.Read(p) }
+func (c hijackedConn) Write(p []byte) (int, error) { return c.Conn.Write(p) }
+func (c hijackedConn) Close() error                { return c.Conn.Close() }
+
+func (d *dockerBackend) Start(ctx context.Context, id string) error {
+	return d.cli.ContainerStart(ctx, id, types.ContainerStartOptions{})
+}
+
+func (d *dockerBackend) Resize(ctx context.Context, id string, height, width uint) error {
+	return d.cli.ContainerResize(ctx, id, types.ResizeOptions{
+		Height: height,
+		Width:  width,
+	})
+}
+
+func (d *dockerBackend) Exec(ctx context.Context, id, user string, cmd []string) (string, io.ReadWriteCloser, error) {
+	r, err := d.cli.ContainerExecCreate(ctx, id, types.ExecConfig{
+		User:         user,
+		Tty:          true,
+		AttachStdin:  true,
+		AttachStdout: true,
+		AttachStderr: true,
+		Cmd:          cmd,
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	// attaching starts the exec
+	attach, err := d.cli.ContainerExecAttach(ctx, r.ID, types.ExecStartCheck{Tty: true})
+	if err != nil {
+		return "", nil, err
+	}
+	return r.ID, hijackedConn{attach}, nil
+}
+
+func (d *dockerBackend) ExecResize(ctx context.Context, execID string, height, width uint) error {
+	return d.cli.ContainerExecResize(ctx, execID, types.ResizeOptions{
+		Height: height,
+		Width:  width,
+	})
+}
+
+func (d *dockerBackend) Remove(ctx context.Context, id string) error {
+	return d.cli.ContainerRemove(ctx, id, types.ContainerRemoveOptions{
+		RemoveVolumes: true,
+		Force:         true,
+	})
+}
+
+func (d *dockerBackend) Inspect(ctx context.Context, id string) (types.ContainerJSON, error) {
+	return d.cli.ContainerInspect(ctx, id)
+}
+
+func (d *dockerBackend) List(ctx context.Context, label string) ([]types.Container, error) {
+	return d.cli.ContainerList(ctx, types.ContainerListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("label", label)),
+	})
+}
+
+func (d *dockerBackend) Info(ctx context.Context) (types.Info, error) {
+	return d.cli.Info(ctx)
+}
+
+func (d *dockerBackend) Negotiate(ctx context.Context) (string, error) {
+	ping, err := d.cli.Ping(ctx)
+	if err != nil {
+		return "", err
+	}
+	d.cli.NegotiateAPIVersionPing(ping)
+	return d.cli.ClientVersion(), nil
+}
+
+func (d *dockerBackend) APIVersion() string {
+	return d.cli.ClientVersion()
+}
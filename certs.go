@@ -0,0 +1,369 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const certsHelp = `Generate the certificates the docker daemons and the server use for TLS.
+
+The directory holds the CA (cacert.pem, cakey.pem), the daemon server
+certificate (server.cert, server.key) and the client certificate of the
+server (client.cert, client.key), plus ca.pem, cert.pem and key.pem copies
+the docker daemon picks up on its own. Start the daemons with
+--tlscacert=cacert.pem --tlscert=server.cert --tlskey=server.key and the
+server with -dcacert cacert.pem -dcert client.cert -dkey client.key.
+
+Running it again only replaces what is missing, invalid or about to expire,
+so it can run from cron to rotate the certificates. -rotate reissues the
+server and client certificates and -rotate-ca the CA as well; after a CA
+rotation cacert.pem holds the new and the previous CA so peers that were not
+restarted yet keep working.`
+
+// Files written by the certs command, the dind make target mounts the
+// directory as /etc/docker/ssl and passes them to the daemon and the server.
+const (
+	caCertFile     = "cacert.pem"
+	caKeyFile      = "cakey.pem"
+	serverCertFile = "server.cert"
+	serverKeyFile  = "server.key"
+	clientCertFile = "client.cert"
+	clientKeyFile  = "client.key"
+)
+
+// certCopies are the copies docker picks up from its certificate directory.
+var certCopies = map[string]string{
+	caCertFile:     "ca.pem",
+	serverCertFile: "cert.pem",
+	serverKeyFile:  "key.pem",
+}
+
+// caSubject is the subject of the generated CA, server and client
+// certificates get their own common name.
+var caSubject = pkix.Name{
+	Country:            []string{"US"},
+	Province:           []string{"New York"},
+	Locality:           []string{"New York City"},
+	Organization:       []string{"Contained.AF"},
+	OrganizationalUnit: []string{"Tupperware Hackers"},
+	CommonName:         "Contained.AF CA",
+}
+
+type certsCommand struct {
+	dir         string
+	hosts       string
+	clientCN    string
+	validity    time.Duration
+	renewBefore time.Duration
+	rotate      bool
+	rotateCA    bool
+}
+
+func (cmd *certsCommand) Name() string { return "certs" }
+func (cmd *certsCommand) Args() string { return "[OPTIONS]" }
+func (cmd *certsCommand) ShortHelp() string {
+	return "Generate the TLS certificates for the docker daemons"
+}
+func (cmd *certsCommand) LongHelp() string { return certsHelp }
+func (cmd *certsCommand) Hidden() bool     { return false }
+
+func (cmd *certsCommand) Register(fs *flag.FlagSet) {
+	fs.StringVar(&cmd.dir, "dir", ".certs", "directory to write the certificates to")
+	fs.StringVar(&cmd.hosts, "hosts", "localhost,127.0.0.1", "comma separated DNS names and IP addresses of the docker daemons")
+	fs.StringVar(&cmd.clientCN, "client-cn", "client", "common name of the client certificate")
+	fs.DurationVar(&cmd.validity, "validity", 365*24*time.Hour, "how long the certificates are valid")
+	fs.DurationVar(&cmd.renewBefore, "renew-before", 30*24*time.Hour, "reissue certificates expiring within this duration")
+	fs.BoolVar(&cmd.rotate, "rotate", false, "reissue the server and client certificates")
+	fs.BoolVar(&cmd.rotateCA, "rotate-ca", false, "reissue the CA and the certificates it signs")
+}
+
+func (cmd *certsCommand) Run(ctx context.Context, args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("unexpected arguments: %s", strings.Join(args, " "))
+	}
+	if cmd.validity <= cmd.renewBefore {
+		return fmt.Errorf("validity (%s) must be longer than renew-before (%s)", cmd.validity, cmd.renewBefore)
+	}
+	dnsNames, ips := splitHosts(cmd.hosts)
+	if len(dnsNames) == 0 && len(ips) == 0 {
+		return errors.New("must pass at least one host for the server certificate")
+	}
+	if err := os.MkdirAll(cmd.dir, 0755); err != nil {
+		return fmt.Errorf("creating certificate directory: %v", err)
+	}
+
+	now := time.Now()
+	ca, caKey, err := loadCertPair(filepath.Join(cmd.dir, caCertFile), filepath.Join(cmd.dir, caKeyFile))
+	if err != nil {
+		return err
+	}
+	var previousCA *x509.Certificate
+	if cmd.rotateCA || ca == nil || expires(ca, now, cmd.renewBefore) {
+		if ca != nil && ca.NotAfter.After(now) {
+			previousCA = ca
+		}
+		ca, caKey, err = cmd.writeCA(previousCA)
+		if err != nil {
+			return err
+		}
+		logrus.Infof("generated CA %s", filepath.Join(cmd.dir, caCertFile))
+	}
+
+	leaves := []struct {
+		certFile, keyFile string
+		template          *x509.Certificate
+	}{
+		{serverCertFile, serverKeyFile, &x509.Certificate{
+			Subject:     pkix.Name{CommonName: cmd.serverCN(dnsNames, ips)},
+			DNSNames:    dnsNames,
+			IPAddresses: ips,
+			ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		}},
+		{clientCertFile, clientKeyFile, &x509.Certificate{
+			Subject:     pkix.Name{CommonName: cmd.clientCN},
+			ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		}},
+	}
+	for _, leaf := range leaves {
+		certFile := filepath.Join(cmd.dir, leaf.certFile)
+		cert, _, err := loadCertPair(certFile, filepath.Join(cmd.dir, leaf.keyFile))
+		if err != nil {
+			return err
+		}
+		if !cmd.rotate && previousCA == nil && cert != nil && !expires(cert, now, cmd.renewBefore) &&
+			cert.CheckSignatureFrom(ca) == nil && sameHosts(cert, leaf.template) {
+			logrus.Debugf("keeping %s, valid until %s", certFile, cert.NotAfter.Format(time.RFC3339))
+			continue
+		}
+		if err := cmd.writeLeaf(leaf.certFile, leaf.keyFile, leaf.template, ca, caKey); err != nil {
+			return err
+		}
+		logrus.Infof("generated certificate %s", certFile)
+	}
+
+	for file, dst := range certCopies {
+		b, err := ioutil.ReadFile(filepath.Join(cmd.dir, file))
+		if err != nil {
+			return err
+		}
+		mode := os.FileMode(0644)
+		if strings.HasSuffix(file, ".key") {
+			mode = 0600
+		}
+		if err := writeFileAtomic(filepath.Join(cmd.dir, dst), b, mode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// serverCN returns the common name of the server certificate, the first
+// host name.
+func (cmd *certsCommand) serverCN(dnsNames []string, ips []net.IP) string {
+	if len(dnsNames) > 0 {
+		return dnsNames[0]
+	}
+	return ips[0].String()
+}
+
+// writeCA generates a new CA. If previous is set it is kept in the CA file
+// after the new one so both are trusted until the peers are rotated.
+func (cmd *certsCommand) writeCA(previous *x509.Certificate) (*x509.Certificate, crypto.Signer, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 4096)
+	if err != nil {
+		return nil, nil, fmt.Errorf("generating CA key: %v", err)
+	}
+	template := &x509.Certificate{
+		Subject:               caSubject,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := cmd.sign(template, template, key, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	ca, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	certs := []*pem.Block{{Type: "CERTIFICATE", Bytes: der}}
+	if previous != nil {
+		certs = append(certs, &pem.Block{Type: "CERTIFICATE", Bytes: previous.Raw})
+	}
+	if err := writePEM(filepath.Join(cmd.dir, caKeyFile), 0600, keyBlock(key)); err != nil {
+		return nil, nil, err
+	}
+	if err := writePEM(filepath.Join(cmd.dir, caCertFile), 0644, certs...); err != nil {
+		return nil, nil, err
+	}
+	return ca, key, nil
+}
+
+// writeLeaf generates a key and a certificate from template signed by ca.
+func (cmd *certsCommand) writeLeaf(certFile, keyFile string, template, ca *x509.Certificate, caKey crypto.Signer) error {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return fmt.Errorf("generating key for %s: %v", certFile, err)
+	}
+	template.KeyUsage = x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment
+	template.BasicConstraintsValid = true
+	der, err := cmd.sign(template, ca, key, caKey)
+	if err != nil {
+		return err
+	}
+	// write the key first so the pair is never mismatched for long
+	if err := writePEM(filepath.Join(cmd.dir, keyFile), 0600, keyBlock(key)); err != nil {
+		return err
+	}
+	return writePEM(filepath.Join(cmd.dir, certFile), 0644, &pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+// sign fills the serial number, validity and key identifiers of template
+// and signs it with the key of parent.
+func (cmd *certsCommand) sign(template, parent *x509.Certificate, key *rsa.PrivateKey, parentKey crypto.Signer) ([]byte, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("generating serial number: %v", err)
+	}
+	pub, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	keyID := sha1.Sum(pub)
+
+	template.SerialNumber = serial
+	template.SubjectKeyId = keyID[:]
+	// allow for clock skew between the hosts
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(cmd.validity)
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		return nil, fmt.Errorf("signing certificate for %s: %v", template.Subject.CommonName, err)
+	}
+	return der, nil
+}
+
+// loadCertPair reads the first certificate in certFile and the key in
+// keyFile. It returns nil if either file does not exist.
+func loadCertPair(certFile, keyFile string) (*x509.Certificate, crypto.Signer, error) {
+	certPEM, err := ioutil.ReadFile(certFile)
+	if os.IsNotExist(err) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	keyPEM, err := ioutil.ReadFile(keyFile)
+	if os.IsNotExist(err) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	block, _ := pem.Decode(certPEM)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, nil, fmt.Errorf("no certificate in %s", certFile)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parsing %s: %v", certFile, err)
+	}
+
+	block, _ = pem.Decode(keyPEM)
+	if block == nil {
+		return nil, nil, fmt.Errorf("no key in %s", keyFile)
+	}
+	var key interface{}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("parsing %s: %v", keyFile, err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, nil, fmt.Errorf("unsupported key type in %s", keyFile)
+	}
+	return cert, signer, nil
+}
+
+// expires returns whether cert is not valid anymore within renewBefore.
+func expires(cert *x509.Certificate, now time.Time, renewBefore time.Duration) bool {
+	return now.Add(renewBefore).After(cert.NotAfter)
+}
+
+// sameHosts returns whether cert is issued for the hosts of template.
+func sameHosts(cert, template *x509.Certificate) bool {
+	return cert.Subject.CommonName == template.Subject.CommonName &&
+		strings.Join(sortedHosts(cert.DNSNames, cert.IPAddresses), ",") ==
+			strings.Join(sortedHosts(template.DNSNames, template.IPAddresses), ",")
+}
+
+func sortedHosts(dnsNames []string, ips []net.IP) []string {
+	hosts := append([]string{}, dnsNames...)
+	for _, ip := range ips {
+		hosts = append(hosts, ip.String())
+	}
+	sort.Strings(hosts)
+	return hosts
+}
+
+// splitHosts splits a comma separated list of hosts into DNS names and IP
+// addresses.
+func splitHosts(hosts string) ([]string, []net.IP) {
+	var (
+		dnsNames []string
+		ips      []net.IP
+	)
+	for _, host := range strings.Split(hosts, ",") {
+		host = strings.TrimSpace(host)
+		if host == "" {
+			continue
+		}
+		if ip := net.ParseIP(host); ip != nil {
+			ips = append(ips, ip)
+			continue
+		}
+		dnsNames = append(dnsNames, host)
+	}
+	return dnsNames, ips
+}
+
+func keyBlock(key *rsa.PrivateKey) *pem.Block {
+	return &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}
+}
+
+// writePEM atomically replaces file with the PEM encoded blocks.
+func writePEM(file string, mode os.FileMode, blocks ...*pem.Block) error {
+	var b []byte
+	for _, block := range blocks {
+		b = append(b, pem.EncodeToMemory(block)...)
+	}
+	return writeFileAtomic(file, b, mode)
+}
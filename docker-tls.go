@@ -0,0 +1,280 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/client"
+	"github.com/docker/go-connections/sockets"
+	"github.com/sirupsen/logrus"
+)
+
+// dockerDaemon holds the address and TLS settings of a docker daemon.
+type dockerDaemon struct {
+	// name describes the daemon in errors.
+	name string
+	host string
+
+	tls                       bool
+	caFile, certFile, keyFile string
+}
+
+// validate checks that the scheme of the daemon address agrees with its TLS
+// settings and returns the parsed address.
+func (d dockerDaemon) validate() (*url.URL, error) {
+	u, err := url.Parse(d.host)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s URL: %v", d.name, err)
+	}
+	if u.Host == "" && u.Scheme != "unix" {
+		return nil, fmt.Errorf("%s URL %q has no host", d.name, d.host)
+	}
+	switch u.Scheme {
+	case "unix":
+		if d.tls {
+			return nil, fmt.Errorf("%s URL %q is a unix socket but TLS is enabled", d.name, d.host)
+		}
+	case "https":
+		if !d.tls {
+			return nil, fmt.Errorf("%s URL %q uses https but TLS is disabled", d.name, d.host)
+		}
+	case "http":
+		if d.tls {
+			return nil, fmt.Errorf("%s URL %q uses http but TLS is enabled, use https or tcp", d.name, d.host)
+		}
+	case "tcp":
+	default:
+		return nil, fmt.Errorf("%s URL %q must use unix, http, https or tcp", d.name, d.host)
+	}
+
+	if (d.certFile == "") != (d.keyFile == "") {
+		return nil, fmt.Errorf("%s needs both a TLS certificate and key", d.name)
+	}
+	if !d.tls && (d.caFile != "" || d.certFile != "") {
+		return nil, fmt.Errorf("%s has TLS files but TLS is disabled", d.name)
+	}
+	return u, nil
+}
+
+// connect returns a backend running containers on the daemon. The TLS files
+// are checked for changes every reloadInterval.
+func (d dockerDaemon) connect(reloadInterval time.Duration) (*dockerBackend, error) {
+	u, err := d.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	transport := &http.Transport{}
+	var tlsConfig *tls.Config
+	if d.tls {
+		tlsConfig = &tls.Config{
+			// Prefer TLS1.2 as the client minimum
+			MinVersion: tls.VersionTLS12,
+			CipherSuites: []uint16{
+				tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+				tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+			},
+		}
+
+		// the CA and client certificate are reloaded when they change
+		certs, err := newCertReloader(d.caFile, d.certFile, d.keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", d.name, err)
+		}
+		certs.configure(tlsConfig)
+		transport.TLSClientConfig = tlsConfig
+
+		// drop the connections made with the previous certificates
+		certs.onReload = transport.CloseIdleConnections
+		go certs.watch(reloadInterval)
+	}
+
+	defaultHeaders := map[string]string{"User-Agent": "engine-api-cli-1.0"}
+	// the client picks http or https from the transport, the scheme is
+	// only checked above
+	host := d.host
+	if u.Scheme != "unix" {
+		host = "tcp://" + u.Host + u.Path
+	}
+	proto, addr := "tcp", u.Host
+	if u.Scheme == "unix" {
+		proto, addr = "unix", u.Path
+	}
+	if err := sockets.ConfigureTransport(transport, proto, addr); err != nil {
+		return nil, fmt.Errorf("configuring %s transport: %v", d.name, err)
+	}
+	httpClient := &http.Client{
+		Transport:     transport,
+		CheckRedirect: client.CheckRedirect,
+	}
+	cli, err := client.NewClient(host, "", httpClient, defaultHeaders)
+	if err != nil {
+		return nil, fmt.Errorf("creating %s client: %v", d.name, err)
+	}
+	return &dockerBackend{cli: cli}, nil
+}
+
+// certReloader holds the CA and client certificate used to talk TLS to the
+// docker daemons and swaps them in when their files change, so rotating the
+// certificates does not need a restart.
+type certReloader struct {
+	caFile, certFile, keyFile string
+
+	// onReload is called after new certificates are swapped in.
+	onReload func()
+
+	mu      sync.RWMutex
+	roots   *x509.CertPool
+	cert    *tls.Certificate
+	modTime map[string]time.Time
+}
+
+// newCertReloader loads the CA in caFile and the key pair in certFile and
+// keyFile, each of which can be empty.
+func newCertReloader(caFile, certFile, keyFile string) (*certReloader, error) {
+	r := &certReloader{caFile: caFile}
+	if certFile != "" && keyFile != "" {
+		r.certFile = certFile
+		r.keyFile = keyFile
+	}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// configure makes cfg use the current certificates for every handshake.
+func (r *certReloader) configure(cfg *tls.Config) {
+	if r.certFile != "" {
+		cfg.GetClientCertificate = r.getClientCertificate
+	}
+	if r.caFile != "" {
+		// the chain is verified in VerifyConnection against the current
+		// roots, as RootCAs cannot be swapped once the config is in use
+		cfg.InsecureSkipVerify = true
+		cfg.VerifyConnection = r.verifyConnection
+	}
+}
+
+func (r *certReloader) files() []string {
+	var files []string
+	for _, f := range []string{r.caFile, r.certFile, r.keyFile} {
+		if f != "" {
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
+// reload loads the certificates from their files. The previous ones are
+// kept if any of them fails to load.
+func (r *certReloader) reload() error {
+	modTime := map[string]time.Time{}
+	for _, f := range r.files() {
+		fi, err := os.Stat(f)
+		if err != nil {
+			return err
+		}
+		modTime[f] = fi.ModTime()
+	}
+
+	var roots *x509.CertPool
+	if r.caFile != "" {
+		var err error
+		roots, err = certPool(r.caFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	var cert *tls.Certificate
+	if r.certFile != "" {
+		c, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+		if err != nil {
+			return fmt.Errorf("Could not load X509 key pair: %v. Make sure the key is not encrypted", err)
+		}
+		cert = &c
+	}
+
+	r.mu.Lock()
+	r.roots = roots
+	r.cert = cert
+	r.modTime = modTime
+	r.mu.Unlock()
+	return nil
+}
+
+// changed returns whether any of the files was modified since the last
+// reload.
+func (r *certReloader) changed() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, f := range r.files() {
+		fi, err := os.Stat(f)
+		if err != nil {
+			// the file is being replaced, check again next time
+			continue
+		}
+		if !fi.ModTime().Equal(r.modTime[f]) {
+			return true
+		}
+	}
+	return false
+}
+
+// watch reloads the certificates every interval if their files changed.
+func (r *certReloader) watch(interval time.Duration) {
+	if interval <= 0 || len(r.files()) == 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if !r.changed() {
+			continue
+		}
+		if err := r.reload(); err != nil {
+			logrus.Errorf("reloading docker TLS certificates failed, keeping the previous ones: %v", err)
+			continue
+		}
+		logrus.Info("reloaded docker TLS certificates")
+		if r.onReload != nil {
+			r.onReload()
+		}
+	}
+}
+
+func (r *certReloader) getClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// verifyConnection verifies the certificate chain of the docker daemon
+// against the current CA.
+func (r *certReloader) verifyConnection(cs tls.ConnectionState) error {
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("docker daemon sent no certificate")
+	}
+	r.mu.RLock()
+	roots := r.roots
+	r.mu.RUnlock()
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range cs.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := cs.PeerCertificates[0].Verify(x509.VerifyOptions{
+		DNSName:       cs.ServerName,
+		Roots:         roots,
+		Intermediates: intermediates,
+	})
+	return err
+}
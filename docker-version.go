@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/versions"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// negotiateAttempts is how often the API version is negotiated with a
+	// docker daemon at startup before giving up.
+	negotiateAttempts = 5
+	// negotiateDelay is the wait between two negotiation attempts.
+	negotiateDelay = 2 * time.Second
+)
+
+// profileFeatures are the profile settings that need a newer docker API than
+// the daemons may have, with the API version they were added in.
+var profileFeatures = []struct {
+	name       string
+	apiVersion string
+	used       func(p *profile) bool
+}{
+	{"pidsLimit", "1.23", func(p *profile) bool { return p.Resources.PidsLimit > 0 }},
+	{"runtime", "1.24", func(p *profile) bool { return p.Runtime != "" }},
+	{"resources.diskSize (storage-opt)", "1.24", func(p *profile) bool { return p.Resources.DiskSize != "" }},
+	{"mounts", "1.25", func(p *profile) bool { return len(p.Mounts) > 0 }},
+}
+
+// daemonFeatures is what a docker daemon supports.
+type daemonFeatures struct {
+	// APIVersion is the API version negotiated with the daemon.
+	APIVersion string
+	// Runtimes are the OCI runtimes the daemon knows.
+	Runtimes []string
+}
+
+// daemonName describes the docker daemon in logs and errors.
+func daemonName(userns bool) string {
+	if userns {
+		return "user namespace enabled docker daemon"
+	}
+	return "docker daemon"
+}
+
+// negotiate agrees on the API version with the docker daemon, trying up to
+// attempts times with delay in between while it cannot be reached.
+func (h *handler) negotiate(userns bool, attempts int, delay time.Duration) error {
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if err = h.ready(userns); err == nil {
+			return nil
+		}
+		logrus.Warnf("%v (attempt %d of %d)", err, attempt, attempts)
+		if attempt < attempts {
+			time.Sleep(delay)
+		}
+	}
+	return err
+}
+
+// ready negotiates the API version with the docker daemon unless that
+// succeeded before. The client of the daemon must not be used until it
+// returns nil, negotiating changes the version the client shared by all the
+// sessions speaks.
+func (h *handler) ready(userns bool) error {
+	h.negotiateMu.Lock()
+	defer h.negotiateMu.Unlock()
+	if h.negotiated[userns] {
+		return nil
+	}
+
+	version, err := h.backend(userns).Negotiate(context.Background())
+	if err != nil {
+		return fmt.Errorf("negotiating API version with %s failed: %v", daemonName(userns), err)
+	}
+	if h.negotiated == nil {
+		h.negotiated = map[bool]bool{}
+	}
+	h.negotiated[userns] = true
+	logrus.Infof("%s: using API version %s", daemonName(userns), version)
+	return nil
+}
+
+// features returns what the docker daemon supports, asking it the first
+// time.
+func (h *handler) features(userns bool) (*daemonFeatures, error) {
+	h.featuresMu.Lock()
+	defer h.featuresMu.Unlock()
+	if f, ok := h.daemonFeatures[userns]; ok {
+		return f, nil
+	}
+	if err := h.ready(userns); err != nil {
+		return nil, err
+	}
+
+	b := h.backend(userns)
+	info, err := b.Info(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("getting %s info failed: %v", daemonName(userns), err)
+	}
+	f := &daemonFeatures{APIVersion: b.APIVersion()}
+	for name := range info.Runtimes {
+		f.Runtimes = append(f.Runtimes, name)
+	}
+	sort.Strings(f.Runtimes)
+
+	if h.daemonFeatures == nil {
+		h.daemonFeatures = map[bool]*daemonFeatures{}
+	}
+	h.daemonFeatures[userns] = f
+	logrus.Infof("%s: runtimes: %s", daemonName(userns), strings.Join(f.Runtimes, ", "))
+	return f, nil
+}
+
+// supports returns an error naming the settings of p the daemon cannot
+// provide.
+func (f *daemonFeatures) supports(p *profile) error {
+	var missing []string
+	for _, feature := range profileFeatures {
+		if feature.used(p) && versions.LessThan(f.APIVersion, feature.apiVersion) {
+			missing = append(missing, fmt.Sprintf("%s (needs API %s)", feature.name, feature.apiVersion))
+		}
+	}
+	if p.Runtime != "" && !containsString(f.Runtimes, p.Runtime) {
+		missing = append(missing, fmt.Sprintf("runtime %q (not configured)", p.Runtime))
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("profile %q needs %s, which the docker daemon (API %s) does not support", p.Name, strings.Join(missing, ", "), f.APIVersion)
+	}
+	return nil
+}
+
+// checkProfile returns an error if the daemon the session runs on cannot run
+// containers with its profile.
+func (h *handler) checkProfile(ctrInfo *containerInfo) error {
+	f, err := h.features(ctrInfo.userns)
+	if err != nil {
+		return err
+	}
+	return f.supports(ctrInfo.profile)
+}
+
+// supportedProfiles returns the profiles both docker daemons can run, as
+// researchers may start every profile on either of them. The others are
+// left out with a warning. A daemon that cannot be reached is asked again
+// when a session is started on it.
+func (h *handler) supportedProfiles(profiles map[string]*profile) map[string]*profile {
+	supported := make(map[string]*profile, len(profiles))
+	for name, p := range profiles {
+		supported[name] = p
+	}
+	for _, userns := range []bool{false, true} {
+		f, err := h.features(userns)
+		if err != nil {
+			logrus.Warnf("%v, sessions on it fail until it can be reached", err)
+			continue
+		}
+		for _, name := range profileNames(supported) {
+			if err := f.supports(supported[name]); err != nil {
+				logrus.Warnf("%s: %v, leaving it out", daemonName(userns), err)
+				delete(supported, name)
+			}
+		}
+	}
+	return supported
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -1,76 +1,89 @@
 package main
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"net/http"
-	"net/url"
-	"os"
+	"io"
+	"sync"
+	"time"
 
-	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/mount"
-	"github.com/docker/docker/client"
-	"github.com/docker/docker/pkg/jsonmessage"
-	"github.com/docker/docker/pkg/term"
 	"github.com/docker/go-connections/nat"
-	"github.com/gorilla/websocket"
 	"github.com/sirupsen/logrus"
 )
 
-// dockerProfile is an abstraction to support different configuration sets for running
-// containers. More information is available here about the supported profiles and their meanings:
-// https://github.com/kinvolk/container-escape-bounty/blob/master/Documentation/profiles.md
-type dockerProfile string
-
-var (
-	defaultDockerProfile dockerProfile = "default-docker"
-	weakDockerProfile    dockerProfile = "weak-docker"
-)
-
-var dockerProfiles = map[dockerProfile]struct{}{
-	defaultDockerProfile: struct{}{},
-	weakDockerProfile:    struct{}{},
-}
-
 type containerInfo struct {
-	dockerImage   string
-	port          string
-	userns        bool
-	containerid   string
-	selinux       bool
-	apparmor      bool
-	dockerProfile dockerProfile
+	sessionID   string
+	researcher  string
+	client      string
+	dockerImage string
+	openPorts   bool
+	ports       []nat.Port
+	userns      bool
+	containerid string
+	selinux     bool
+	apparmor    bool
+	profile     *profile
+
+	// resumeToken lets a browser come back to the session after losing its
+	// websocket.
+	resumeToken string
+	// slot is the place of the session in the session limiter.
+	slot *sessionSlot
+	// recording records the terminal of the session.
+	recording *recording
+	// spectators are watching the terminal of the session.
+	spectators *spectators
+
+	// tty is attached to the terminal of the container and timer tracks the
+	// session limits, both are set once the container started.
+	tty   io.ReadWriteCloser
+	timer *sessionTimer
+
+	// browserMu guards browser, the websocket of the browser of the
+	// session, nil while it is away, attachments, counting the browsers
+	// that attached to it, screen, the latest output of the container for
+	// a browser resuming the session, and the extra terminals opened in the
+	// container, with openingTerminals counting the ones being opened.
+	browserMu        sync.Mutex
+	browser          *lockedConn
+	attachments      int
+	screen           *ringBuffer
+	terminals        []*terminal
+	openingTerminals int
+	nextTerminal     int
+
+	// removed is closed once the container is removed. createMu is held
+	// while the container is created, so it is either created before the
+	// session is removed, and removed with it, or not at all.
+	removed  chan struct{}
+	createMu sync.Mutex
+
+	removeOnce sync.Once
+	removeErr  error
 }
 
-func validatePort(portStr string) (nat.Port, error) {
-	if portStr == "" {
-		return "", nil
-	}
-	port, err := nat.NewPort("tcp", portStr)
-	if err != nil {
-		return "", err
-	}
-	portInt := port.Int()
-	if portInt < 36100 || portInt > 36110 {
-		// this is the allowed range of open ports defined in terraform config
-		// https://github.com/kinvolk/container-escape-bounty/pull/19
-		return "", fmt.Errorf("port not in range [36100, 36110], given: %d", portInt)
-	}
-	return port, nil
+// logger returns a logger for the session, every line carries the session
+// and researcher IDs.
+func (c *containerInfo) logger() *logrus.Entry {
+	return logrus.WithFields(logrus.Fields{
+		"session":    c.sessionID,
+		"researcher": c.researcher,
+	})
 }
 
 type containerOptions func(cfg *container.Config)
 
-func withPort(port nat.Port) containerOptions {
+func withPorts(ports []nat.Port) containerOptions {
 	return func(ctrCfg *container.Config) {
-		if port == "" {
+		if len(ports) == 0 {
 			return
 		}
-		ctrCfg.ExposedPorts = nat.PortSet{
-			port: struct{}{},
+		ctrCfg.ExposedPorts = nat.PortSet{}
+		for _, port := range ports {
+			ctrCfg.ExposedPorts[port] = struct{}{}
 		}
 	}
 }
@@ -85,53 +98,50 @@ func withDockerImage(image string) containerOptions {
 	}
 }
 
-func withDockerUser(profile dockerProfile) containerOptions {
+func withLabels(ctrInfo *containerInfo, instanceID string) containerOptions {
 	return func(cfg *container.Config) {
-		// By default, use the defaultDockerProfile.
-		user := "nobody"
-		if profile == weakDockerProfile {
-			user = ""
+		cfg.Labels = map[string]string{
+			sessionLabel:  ctrInfo.sessionID,
+			profileLabel:  ctrInfo.profile.Name,
+			createdLabel:  time.Now().UTC().Format(time.RFC3339),
+			instanceLabel: instanceID,
 		}
+		if ctrInfo.researcher != "" {
+			cfg.Labels[researcherLabel] = ctrInfo.researcher
+		}
+	}
+}
 
-		cfg.User = user
+func withDockerUser(p *profile) containerOptions {
+	return func(cfg *container.Config) {
+		cfg.User = p.User
 	}
 }
 
 type hostOptions func(cfg *container.HostConfig) error
 
-func withExposedPort(port nat.Port) hostOptions {
+func withExposedPorts(ports []nat.Port) hostOptions {
 	return func(cfg *container.HostConfig) error {
-		if port == "" {
+		if len(ports) == 0 {
 			return nil
 		}
-		cfg.PortBindings = map[nat.Port][]nat.PortBinding{
-			port: []nat.PortBinding{
+		cfg.PortBindings = nat.PortMap{}
+		for _, port := range ports {
+			cfg.PortBindings[port] = []nat.PortBinding{
 				{
 					HostIP:   "0.0.0.0",
-					HostPort: string(port),
+					HostPort: port.Port(),
 				},
-			},
+			}
 		}
 		return nil
 	}
 }
 
-func withSecurityOptions(profile dockerProfile, selinux bool, apparmor bool) hostOptions {
+func withSecurityOptions(p *profile, selinux bool, apparmor bool) hostOptions {
 	return func(cfg *container.HostConfig) error {
-		seccompConfig, ok := seccompConfigs[profile]
-		if !ok {
-			return fmt.Errorf("seccomp config not found for profile: %q", profile)
-		}
-
-		b := bytes.NewBuffer(nil)
-		if err := json.Compact(b, []byte(seccompConfig)); err != nil {
-			// this should be caught while development itself and not during runtime
-			panic(fmt.Sprintf("compacting json for seccomp profile failed: %v", err))
-		}
-		cfg.SecurityOpt = []string{
-			"no-new-privileges",
-			fmt.Sprintf("seccomp=%s", b.Bytes()),
-		}
+		cfg.SecurityOpt = append([]string{}, p.SecurityOpt...)
+		cfg.SecurityOpt = append(cfg.SecurityOpt, fmt.Sprintf("seccomp=%s", p.seccompJSON))
 		// SELinux is enabled by default if user asks to disable it only then we
 		// do it
 		if !selinux {
@@ -146,28 +156,39 @@ func withSecurityOptions(profile dockerProfile, selinux bool, apparmor bool) hos
 	}
 }
 
-func withHostVolumes(profile dockerProfile) hostOptions {
+func withHostVolumes(p *profile) hostOptions {
 	return func(cfg *container.HostConfig) error {
-		if profile == weakDockerProfile {
-			cfg.Mounts = []mount.Mount{
-				{
-					Type:        mount.TypeBind,
-					Source:      "/var/tmp/shared",
-					Target:      "/var/tmp/shared",
-					ReadOnly:    false,
-					Consistency: mount.ConsistencyDefault,
-				},
-			}
+		for _, m := range p.Mounts {
+			cfg.Mounts = append(cfg.Mounts, mount.Mount{
+				Type:        m.Type,
+				Source:      m.Source,
+				Target:      m.Target,
+				ReadOnly:    m.ReadOnly,
+				Consistency: mount.ConsistencyDefault,
+			})
 		}
 		return nil
 	}
 }
 
-func withCapabilities(profile dockerProfile) hostOptions {
+func withCapabilities(p *profile) hostOptions {
 	return func(cfg *container.HostConfig) error {
-		if profile == weakDockerProfile {
-			cfg.CapAdd = []string{"NET_ADMIN", "SYS_PTRACE", "SYS_CHROOT"}
-		}
+		cfg.CapAdd = p.CapAdd
+		cfg.CapDrop = p.CapDrop
+		return nil
+	}
+}
+
+func withRuntime(p *profile) hostOptions {
+	return func(cfg *container.HostConfig) error {
+		cfg.Runtime = p.Runtime
+		return nil
+	}
+}
+
+func withResources(p *profile) hostOptions {
+	return func(cfg *container.HostConfig) error {
+		p.Resources.apply(cfg)
 		return nil
 	}
 }
@@ -197,7 +218,7 @@ func NewContainerHostConfig(opts ...hostOptions) (*container.HostConfig, error)
 			Type: "none",
 		},
 		Resources: container.Resources{
-			PidsLimit: 5,
+			PidsLimit: defaultPidsLimit,
 		},
 	}
 
@@ -210,25 +231,32 @@ func NewContainerHostConfig(opts ...hostOptions) (*container.HostConfig, error)
 	return cfg, nil
 }
 
-// startContainer starts a docker container and returns the container ID
-// as well as a websocket connection to the attach endpoint.
-func (h *handler) startContainer(ctrInfo *containerInfo) (*websocket.Conn, error) {
-	port, err := validatePort(ctrInfo.port)
-	if err != nil {
-		return nil, err
+// startContainer starts a docker container and returns the connection
+// attached to its tty.
+func (h *handler) startContainer(ctrInfo *containerInfo) (io.ReadWriteCloser, error) {
+	// lease the host ports the container is published on
+	if ctrInfo.openPorts {
+		ports, err := h.ports.lease(ctrInfo.sessionID, ctrInfo.profile.Ports)
+		if err != nil {
+			return nil, err
+		}
+		ctrInfo.ports = ports
 	}
 
 	ctrCfg := NewContainerConfig(
-		withPort(port),
+		withPorts(ctrInfo.ports),
 		withDockerImage(ctrInfo.dockerImage),
-		withDockerUser(ctrInfo.dockerProfile),
+		withDockerUser(ctrInfo.profile),
+		withLabels(ctrInfo, h.instanceID),
 	)
 
 	ctrHostCfg, err := NewContainerHostConfig(
-		withExposedPort(port),
-		withSecurityOptions(ctrInfo.dockerProfile, ctrInfo.selinux, ctrInfo.apparmor),
-		withHostVolumes(ctrInfo.dockerProfile),
-		withCapabilities(ctrInfo.dockerProfile),
+		withExposedPorts(ctrInfo.ports),
+		withSecurityOptions(ctrInfo.profile, ctrInfo.selinux, ctrInfo.apparmor),
+		withHostVolumes(ctrInfo.profile),
+		withCapabilities(ctrInfo.profile),
+		withResources(ctrInfo.profile),
+		withRuntime(ctrInfo.profile),
 	)
 	if err != nil {
 		return nil, fmt.Errorf("creating container host config: %v", err)
@@ -238,102 +266,65 @@ func (h *handler) startContainer(ctrInfo *containerInfo) (*websocket.Conn, error
 	ctrInfo.dockerImage = ctrCfg.Image
 
 	// pull container image if we don't already have it
-	if err := h.pullImage(ctrInfo); err != nil {
+	b := h.backend(ctrInfo.userns)
+	if err := b.Pull(context.Background(), ctrCfg.Image); err != nil {
 		return nil, fmt.Errorf("pulling %s failed: %v", ctrCfg.Image, err)
 	}
 
-	// create the container
-	r, err := h.client(ctrInfo.userns).ContainerCreate(context.Background(), ctrCfg,
-		ctrHostCfg, nil, "")
+	// create the container, unless the session was removed meanwhile, like
+	// on shutdown
+	ctrInfo.createMu.Lock()
+	if ctrInfo.isRemoved() {
+		ctrInfo.createMu.Unlock()
+		return nil, errors.New("session ended before its container was created")
+	}
+	id, err := b.Create(context.Background(), ctrCfg, ctrHostCfg)
 	if err != nil {
+		ctrInfo.createMu.Unlock()
 		return nil, err
 	}
-	ctrInfo.containerid = r.ID
-
-	// connect to the attach websocket endpoint
-	header := http.Header(make(map[string][]string))
-	header.Add("Origin", h.url(ctrInfo.userns).String())
-	v := url.Values{
-		"stdin":  []string{"1"},
-		"stdout": []string{"1"},
-		"stderr": []string{"1"},
-		"stream": []string{"1"},
-	}
-	proto := "ws"
-	if h.tls_ws {
-		proto = "wss"
-	}
-	wsURL := fmt.Sprintf("%s://%s/%s/containers/%s/attach/ws?%s",
-		proto, h.url(ctrInfo.userns).Host, dockerAPIVersion, r.ID, v.Encode())
-	var dialer = &websocket.Dialer{
-		Proxy:           http.ProxyFromEnvironment,
-		TLSClientConfig: h.tlsConfig,
-	}
-	conn, _, err := dialer.Dial(wsURL, header)
+	ctrInfo.containerid = id
+	ctrInfo.createMu.Unlock()
+
+	// attach before starting so no output is missed
+	attach, err := b.Attach(context.Background(), id)
 	if err != nil {
-		return nil, fmt.Errorf("dialing %s with header %#v failed: %v",
-			wsURL, header, err)
+		return nil, fmt.Errorf("attaching to container failed: %v", err)
 	}
 
 	// start the container
-	if err := h.client(ctrInfo.userns).ContainerStart(context.Background(),
-		r.ID, types.ContainerStartOptions{}); err != nil {
-		return conn, err
+	if err := b.Start(context.Background(), id); err != nil {
+		attach.Close()
+		return nil, err
 	}
 
-	return conn, nil
+	return attach, nil
 }
 
-// removeContainer removes with force a container by it's container ID.
+// removeContainer removes with force a container by it's container ID. It
+// only removes the container once, later calls return the first result.
 func (h *handler) removeContainer(ctrInfo *containerInfo) error {
-	if err := h.client(ctrInfo.userns).ContainerRemove(
-		context.Background(),
-		ctrInfo.containerid,
-		types.ContainerRemoveOptions{
-			RemoveVolumes: true,
-			Force:         true,
-		}); err != nil {
-		return err
-	}
-
-	logrus.Debugf("removed container: %s", ctrInfo.containerid)
-
-	return nil
-}
-
-// pullImage requests a docker image if it doesn't exist already.
-func (h *handler) pullImage(ctrInfo *containerInfo) error {
-	exists, err := h.imageExists(ctrInfo)
-	if err != nil {
-		return err
-	}
-
-	if exists {
-		return nil
-	}
-
-	resp, err := h.client(ctrInfo.userns).ImagePull(context.Background(),
-		ctrInfo.dockerImage, types.ImagePullOptions{})
-	if err != nil {
-		return err
-	}
-
-	fd, isTerm := term.GetFdInfo(os.Stdout)
-
-	return jsonmessage.DisplayJSONMessagesStream(resp, os.Stdout, fd, isTerm, nil)
-}
-
-// imageExists checks if a docker image exists.
-func (h *handler) imageExists(ctrInfo *containerInfo) (bool, error) {
-	_, _, err := h.client(ctrInfo.userns).ImageInspectWithRaw(
-		context.Background(), ctrInfo.dockerImage)
-	if err == nil {
-		return true, nil
-	}
-
-	if client.IsErrNotFound(err) {
-		return false, nil
-	}
-
-	return false, err
+	ctrInfo.removeOnce.Do(func() {
+		// if the removal fails the reaper picks the container up
+		defer h.untrackSession(ctrInfo)
+		defer h.ports.release(ctrInfo.sessionID)
+		defer h.limiter.release(ctrInfo.slot)
+		defer ctrInfo.spectators.close()
+		// wait for a container being created
+		ctrInfo.createMu.Lock()
+		if ctrInfo.containerid != "" {
+			ctrInfo.removeErr = h.backend(ctrInfo.userns).Remove(context.Background(), ctrInfo.containerid)
+			if ctrInfo.removeErr == nil {
+				ctrInfo.logger().Debugf("removed container: %s", ctrInfo.containerid)
+			}
+		}
+		// end the session even if the container could not be removed
+		close(ctrInfo.removed)
+		ctrInfo.createMu.Unlock()
+		if tty := ctrInfo.terminal(); tty != nil {
+			tty.Close()
+		}
+		ctrInfo.closeTerminals()
+	})
+	return ctrInfo.removeErr
 }
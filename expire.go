@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// expireCheckInterval is how often the session limits are checked.
+	expireCheckInterval = time.Second
+	// expireWarnInterval is how often the browser is warned while the
+	// session is about to expire.
+	expireWarnInterval = 10 * time.Second
+)
+
+// sessionTimer tracks the lifetime and the last input of a session.
+type sessionTimer struct {
+	limits  profileSession
+	started time.Time
+
+	mu        sync.Mutex
+	lastInput time.Time
+}
+
+func newSessionTimer(limits profileSession) *sessionTimer {
+	now := time.Now()
+	return &sessionTimer{
+		limits:    limits,
+		started:   now,
+		lastInput: now,
+	}
+}
+
+// touch records input from the browser.
+func (t *sessionTimer) touch() {
+	t.mu.Lock()
+	t.lastInput = time.Now()
+	t.mu.Unlock()
+}
+
+// deadline returns when the session expires and why, ok is false if the
+// session never expires.
+func (t *sessionTimer) deadline() (deadline time.Time, reason string, ok bool) {
+	if t.limits.MaxLifetime.Duration > 0 {
+		deadline = t.started.Add(t.limits.MaxLifetime.Duration)
+		reason = fmt.Sprintf("maximum lifetime of %s", t.limits.MaxLifetime)
+		ok = true
+	}
+	if t.limits.IdleTimeout.Duration > 0 {
+		t.mu.Lock()
+		idle := t.lastInput.Add(t.limits.IdleTimeout.Duration)
+		t.mu.Unlock()
+		if !ok || idle.Before(deadline) {
+			deadline = idle
+			reason = fmt.Sprintf("idle timeout of %s", t.limits.IdleTimeout)
+			ok = true
+		}
+	}
+	return deadline, reason, ok
+}
+
+// enforceSessionLimits warns the browser when the session is about to expire
+// and removes the container once it has. It returns when the container is
+// removed.
+func (h *handler) enforceSessionLimits(ctrInfo *containerInfo) {
+	t := ctrInfo.timer
+	if _, _, ok := t.deadline(); !ok {
+		return
+	}
+
+	ticker := time.NewTicker(expireCheckInterval)
+	defer ticker.Stop()
+
+	var lastWarning time.Time
+	for {
+		var now time.Time
+		select {
+		case <-ctrInfo.removed:
+			return
+		case now = <-ticker.C:
+		}
+
+		deadline, reason, _ := t.deadline()
+		left := deadline.Sub(now)
+		if left <= 0 {
+			ctrInfo.logger().Infof("session of container %s expired: %s", ctrInfo.containerid, reason)
+			if err := ctrInfo.send(message{
+				Type: "expired",
+				Data: fmt.Sprintf("Session expired (%s).", reason),
+			}); err != nil {
+				ctrInfo.logger().Errorf("writing expired message to browser websocket failed: %v", err)
+			}
+			// cleanup and remove the container
+			if err := h.removeContainer(ctrInfo); err != nil {
+				ctrInfo.logger().Errorf("removing container %s failed: %v", ctrInfo.containerid, err)
+			}
+			// cleanly close the browser connection
+			ctrInfo.closeBrowser(websocket.CloseNormalClosure, "session expired")
+			return
+		}
+
+		if left > t.limits.WarnBefore.Duration || now.Sub(lastWarning) < expireWarnInterval {
+			continue
+		}
+		lastWarning = now
+		if err := ctrInfo.send(message{
+			Type: "expiring",
+			Data: fmt.Sprintf("Session expiring in %d seconds (%s).", int(left.Round(time.Second).Seconds()), reason),
+		}); err != nil {
+			ctrInfo.logger().Errorf("writing expiring message to browser websocket failed: %v", err)
+		}
+	}
+}
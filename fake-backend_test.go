@@ -0,0 +1,363 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+)
+
+// fakeBackend is an in-memory backend. Its containers echo their input back
+// on their tty until they are removed or told to exit, and container IDs are
+// handed out in order so tests are deterministic.
+type fakeBackend struct {
+	apiVersion string
+	runtimes   []string
+	// unreachable is how many calls to Negotiate fail.
+	unreachable int
+	// execWait, if not nil, holds up Exec until it is closed.
+	execWait chan struct{}
+
+	mu         sync.Mutex
+	nextID     int
+	nextExecID int
+	containers map[string]*fakeContainer
+	pulled     []string
+}
+
+// fakeContainer is a container of the fakeBackend.
+type fakeContainer struct {
+	id      string
+	config  *container.Config
+	hostCfg *container.HostConfig
+
+	running  bool
+	exitCode int
+	height   uint
+	width    uint
+
+	// tty is the container end of the attached connection.
+	tty net.Conn
+	// execs are the processes run in the container with Exec.
+	execs []*fakeExec
+}
+
+// fakeExec is a process run in a fakeContainer. It echoes its input back on
+// its tty like the container.
+type fakeExec struct {
+	id     string
+	user   string
+	cmd    []string
+	height uint
+	width  uint
+	tty    net.Conn
+}
+
+func newFakeBackend() *fakeBackend {
+	return &fakeBackend{
+		apiVersion: "1.38",
+		runtimes:   []string{"runc"},
+		containers: map[string]*fakeContainer{},
+	}
+}
+
+func (f *fakeBackend) Pull(ctx context.Context, image string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !containsString(f.pulled, image) {
+		f.pulled = append(f.pulled, image)
+	}
+	return nil
+}
+
+func (f *fakeBackend) Create(ctx context.Context, cfg *container.Config, hostCfg *container.HostConfig) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !containsString(f.pulled, cfg.Image) {
+		return "", fmt.Errorf("No such image: %s", cfg.Image)
+	}
+	f.nextID++
+	id := fmt.Sprintf("fake%04d", f.nextID)
+	f.containers[id] = &fakeContainer{
+		id:      id,
+		config:  cfg,
+		hostCfg: hostCfg,
+	}
+	return id, nil
+}
+
+func (f *fakeBackend) container(id string) (*fakeContainer, error) {
+	c, ok := f.containers[id]
+	if !ok {
+		return nil, fmt.Errorf("No such container: %s", id)
+	}
+	return c, nil
+}
+
+func (f *fakeBackend) Attach(ctx context.Context, id string) (io.ReadWriteCloser, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	c, err := f.container(id)
+	if err != nil {
+		return nil, err
+	}
+	if c.tty != nil {
+		return nil, fmt.Errorf("container %s is already attached", id)
+	}
+	server, tty := net.Pipe()
+	c.tty = tty
+	return server, nil
+}
+
+func (f *fakeBackend) Start(ctx context.Context, id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	c, err := f.container(id)
+	if err != nil {
+		return err
+	}
+	if c.running {
+		return fmt.Errorf("container %s is already running", id)
+	}
+	c.running = true
+	if c.tty != nil {
+		go io.Copy(c.tty, c.tty)
+	}
+	return nil
+}
+
+func (f *fakeBackend) Resize(ctx context.Context, id string, height, width uint) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	c, err := f.container(id)
+	if err != nil {
+		return err
+	}
+	c.height, c.width = height, width
+	return nil
+}
+
+func (f *fakeBackend) Exec(ctx context.Context, id, user string, cmd []string) (string, io.ReadWriteCloser, error) {
+	if f.execWait != nil {
+		<-f.execWait
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	c, err := f.container(id)
+	if err != nil {
+		return "", nil, err
+	}
+	if !c.running {
+		return "", nil, fmt.Errorf("Container %s is not running", id)
+	}
+	f.nextExecID++
+	server, tty := net.Pipe()
+	e := &fakeExec{
+		id:   fmt.Sprintf("exec%04d", f.nextExecID),
+		user: user,
+		cmd:  cmd,
+		tty:  tty,
+	}
+	c.execs = append(c.execs, e)
+	go io.Copy(tty, tty)
+	return e.id, server, nil
+}
+
+func (f *fakeBackend) ExecResize(ctx context.Context, execID string, height, width uint) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	e, err := f.exec(execID)
+	if err != nil {
+		return err
+	}
+	e.height, e.width = height, width
+	return nil
+}
+
+func (f *fakeBackend) exec(execID string) (*fakeExec, error) {
+	for _, c := range f.containers {
+		for _, e := range c.execs {
+			if e.id == execID {
+				return e, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("No such exec instance: %s", execID)
+}
+
+func (f *fakeBackend) Remove(ctx context.Context, id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	c, err := f.container(id)
+	if err != nil {
+		return err
+	}
+	if c.tty != nil {
+		c.tty.Close()
+	}
+	for _, e := range c.execs {
+		e.tty.Close()
+	}
+	delete(f.containers, id)
+	return nil
+}
+
+func (f *fakeBackend) Inspect(ctx context.Context, id string) (types.ContainerJSON, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	c, err := f.container(id)
+	if err != nil {
+		return types.ContainerJSON{}, err
+	}
+	return types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			ID: c.id,
+			State: &types.ContainerState{
+				Running:  c.running,
+				ExitCode: c.exitCode,
+			},
+			HostConfig: c.hostCfg,
+		},
+		Config: c.config,
+	}, nil
+}
+
+// List returns the containers with label, which is a key or a key=value
+// pair like the docker label filter.
+func (f *fakeBackend) List(ctx context.Context, label string) ([]types.Container, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	key, value, withValue := label, "", false
+	if i := strings.Index(label, "="); i >= 0 {
+		key, value, withValue = label[:i], label[i+1:], true
+	}
+
+	var ctrs []types.Container
+	for _, id := range f.ids() {
+		c := f.containers[id]
+		v, ok := c.config.Labels[key]
+		if !ok || (withValue && v != value) {
+			continue
+		}
+		state := "created"
+		if c.running {
+			state = "running"
+		}
+		ctrs = append(ctrs, types.Container{
+			ID:     c.id,
+			Image:  c.config.Image,
+			Labels: c.config.Labels,
+			State:  state,
+		})
+	}
+	return ctrs, nil
+}
+
+func (f *fakeBackend) Info(ctx context.Context) (types.Info, error) {
+	info := types.Info{
+		OperatingSystem: "fake",
+		Runtimes:        map[string]types.Runtime{},
+	}
+	for _, name := range f.runtimes {
+		info.Runtimes[name] = types.Runtime{Path: name}
+	}
+	return info, nil
+}
+
+func (f *fakeBackend) Negotiate(ctx context.Context) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.unreachable > 0 {
+		f.unreachable--
+		return "", errors.New("daemon unreachable")
+	}
+	return f.apiVersion, nil
+}
+
+func (f *fakeBackend) APIVersion() string {
+	return f.apiVersion
+}
+
+// ids returns the IDs of the containers in the order they were created.
+func (f *fakeBackend) ids() []string {
+	ids := make([]string, 0, len(f.containers))
+	for id := range f.containers {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// snapshot returns copies of the containers that were not removed, in the
+// order they were created.
+func (f *fakeBackend) snapshot() []fakeContainer {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var ctrs []fakeContainer
+	for _, id := range f.ids() {
+		c := *f.containers[id]
+		c.execs = nil
+		for _, e := range f.containers[id].execs {
+			e := *e
+			c.execs = append(c.execs, &e)
+		}
+		ctrs = append(ctrs, c)
+	}
+	return ctrs
+}
+
+// exit makes the process of a container exit with code, closing its tty and
+// the ones of its execs.
+func (f *fakeBackend) exit(id string, code int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	c, err := f.container(id)
+	if err != nil {
+		return err
+	}
+	c.running = false
+	c.exitCode = code
+	if c.tty != nil {
+		c.tty.Close()
+	}
+	// the execs are killed with the container
+	for _, e := range c.execs {
+		e.tty.Close()
+	}
+	return nil
+}
+
+// exitExec makes an exec process exit, closing its tty.
+func (f *fakeBackend) exitExec(execID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	e, err := f.exec(execID)
+	if err != nil {
+		return err
+	}
+	e.tty.Close()
+	return nil
+}
+
+// add creates a container that was not created through a session, like one
+// left behind by an earlier run of the server.
+func (f *fakeBackend) add(labels map[string]string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.nextID++
+	id := fmt.Sprintf("fake%04d", f.nextID)
+	f.containers[id] = &fakeContainer{
+		id:      id,
+		config:  &container.Config{Image: defaultDockerImage, Labels: labels},
+		hostCfg: &container.HostConfig{},
+		running: true,
+	}
+	return id
+}
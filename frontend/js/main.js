@@ -24,12 +24,13 @@
 			return Math.floor(parseInt(computedStyle(elem, name), 10) / dimensions[name === 'width' ? 0 : 1]);
 		};
 
-		var windowSize = function(term, socket) {
+		var windowSize = function(term, socket, id) {
 			term.fit();
 			socket.send(JSON.stringify({
 				type: 'resize',
 				width: term.cols,
-				height: term.rows
+				height: term.rows,
+				terminal: id || undefined
 			}));
 		};
         var loadQuestion = function(index) {
@@ -120,10 +121,49 @@
         }
 
         var urlParams = new URLSearchParams(window.location.search);
+
+		// the access token is kept for the tab and sent as a websocket
+		// subprotocol, so it stays out of URLs, the history and server logs
+		var tokenKey = 'contained.af.token';
+		if (urlParams.has('token')) {
+			sessionStorage.setItem(tokenKey, urlParams.get('token'));
+			urlParams.delete('token');
+			history.replaceState(null, '', location.pathname + '?' + urlParams.toString());
+		}
         console.log("params in main: ", urlParams.toString());
 
-		// create the socket
-		var socket = new WebSocket(proto+'://'+location.host+"/profiles?"+urlParams.toString());
+		// term.html?replay=<session ID> replays a recorded session and
+		// term.html?spectate=<session ID> watches a live one, both read-only
+		var replay = urlParams.get('replay');
+		var spectate = urlParams.get('spectate');
+		var readOnly = replay || spectate;
+		var endpoint = "/profiles?";
+		if (replay) {
+			urlParams.delete('replay');
+			urlParams.set('session', replay);
+			endpoint = "/replay?";
+		} else if (spectate) {
+			urlParams.delete('spectate');
+			urlParams.set('session', spectate);
+			endpoint = "/spectate?";
+		}
+
+		// the server hands out a token to resume the session when the
+		// websocket drops, kept for the tab so it also survives a reload
+		var resumeKey = 'contained.af.resume';
+		var resumeAttempts = 0;
+		var maxResumeAttempts = 5;
+		var resuming = false;
+		var url = function() {
+			var token = readOnly ? null : sessionStorage.getItem(resumeKey);
+			resuming = !!token;
+			if (token) {
+				return proto+'://'+location.host+'/profiles?resume='+encodeURIComponent(token);
+			}
+			return proto+'://'+location.host+endpoint+urlParams.toString();
+		};
+
+		var socket;
 
 		var term = new Terminal({
 			cursorBlink: true
@@ -135,31 +175,256 @@
 
 		term.open(elem);
 
-		socket.onopen = function (event) {
-			windowSize(term, socket);
-            loadQuestion(0);
+		// the other shells opened in the container, by terminal ID, each in
+		// its own tab
+		var terminals = {};
+		var active = '';
+		var opening = 0;
+
+		var showTerminal = function(id) {
+			active = id;
+			$('#terminals li').removeClass('active');
+			$('#terminals a[data-terminal="' + id + '"]').parent().addClass('active');
+			$(elem).toggleClass('hide', id !== '');
+			$.each(terminals, function(other, t) {
+				$(t.elem).toggleClass('hide', other !== id);
+			});
+			var shown = id ? terminals[id].term : term;
+			if (!readOnly) {
+				windowSize(shown, socket, id);
+			}
+			shown.focus();
 		};
 
-		term.on('data', function(data) {
+		var addTerminal = function(id) {
+			if (terminals[id]) {
+				// a resumed session sends the scrollback again
+				terminals[id].term.reset();
+				return;
+			}
+			var div = document.createElement('div');
+			div.className = 'console hide';
+			elem.parentNode.insertBefore(div, document.getElementById('status'));
+			var t = new Terminal({
+				cursorBlink: true
+			});
+			t.open(div);
+			t.on('data', function(data) {
+				input(data, id);
+			});
+			var tab = $('<li><a href="#"><span class="close-terminal" title="Close this shell">&times;</span></a></li>');
+			tab.find('a').attr('data-terminal', id).prepend(document.createTextNode('Shell ' + id + ' '));
+			if (readOnly) {
+				// replays and spectators cannot close the shells
+				tab.find('.close-terminal').remove();
+				$('#new-terminal').parent().addClass('hide');
+				$('#terminals').removeClass('hide');
+			}
+			tab.insertBefore($('#new-terminal').parent());
+			terminals[id] = {term: t, elem: div, tab: tab};
+			if (opening > 0) {
+				opening--;
+				showTerminal(id);
+			}
+		};
+
+		var removeTerminal = function(id) {
+			var t = terminals[id];
+			if (!t) {
+				return;
+			}
+			delete terminals[id];
+			t.term.destroy();
+			$(t.elem).remove();
+			t.tab.remove();
+			if (active === id) {
+				showTerminal('');
+			}
+		};
+
+		$('#terminals').on('click', 'a[data-terminal]', function(event) {
+			event.preventDefault();
+			showTerminal($(this).attr('data-terminal'));
+		});
+
+		$('#terminals').on('click', '.close-terminal', function(event) {
+			event.preventDefault();
+			event.stopPropagation();
 			socket.send(JSON.stringify({
-				type:'stdin',
-				data: data
+				type: 'close',
+				terminal: $(this).parent().attr('data-terminal')
 			}));
 		});
 
-		socket.onmessage = function (event) {
-			//console.log("input", JSON.stringify(event));
-			var obj = JSON.parse(event.data);
-			//console.log("data", obj.data);
-			term.write(obj.data);
+		$('#new-terminal').click(function(event) {
+			event.preventDefault();
+			opening++;
+			socket.send(JSON.stringify({
+				type: 'terminal',
+				width: term.cols,
+				height: term.rows
+			}));
+		});
+
+		// keys controlling a replay: space pauses and resumes, the arrows
+		// seek 10 seconds, + and - change the speed and 0 starts over
+		var paused = false;
+		var speed = parseFloat(urlParams.get('speed')) || 1;
+		var replayControl = function(data) {
+			switch (data) {
+			case ' ':
+				paused = !paused;
+				return {type: paused ? 'pause' : 'resume'};
+			case '\x1b[C':
+				return {type: 'seek', data: '+10'};
+			case '\x1b[D':
+				return {type: 'seek', data: '-10'};
+			case '+':
+				speed = Math.min(speed * 2, 64);
+				return {type: 'speed', data: String(speed)};
+			case '-':
+				speed = Math.max(speed / 2, 0.25);
+				return {type: 'speed', data: String(speed)};
+			case '0':
+				return {type: 'seek', data: '0'};
+			}
+			return null;
 		};
 
-		socket.onclose = function (event) {
-			term.destroy()
+		// input sends what is typed in the terminal id, empty for the
+		// terminal of the container
+		var input = function(data, id) {
+			if (replay) {
+				var control = replayControl(data);
+				if (control) {
+					socket.send(JSON.stringify(control));
+				}
+				return;
+			}
+			if (spectate) {
+				return;
+			}
+			socket.send(JSON.stringify({
+				type:'stdin',
+				data: data,
+				terminal: id || undefined
+			}));
+		};
+
+		term.on('data', function(data) {
+			input(data);
+		});
+
+		var connect = function() {
+			var accessToken = sessionStorage.getItem(tokenKey);
+			socket = new WebSocket(url(), accessToken ? ['contained.af', accessToken] : []);
+
+			socket.onopen = function (event) {
+				var reconnected = resumeAttempts > 0;
+				resumeAttempts = 0;
+				if (readOnly) {
+					return;
+				}
+				$('#terminals').removeClass('hide');
+				windowSize(term, socket);
+				if (!reconnected) {
+					loadQuestion(0);
+				}
+			};
+
+			socket.onmessage = function (event) {
+				//console.log("input", JSON.stringify(event));
+				var obj = JSON.parse(event.data);
+				//console.log("data", obj.data);
+				switch (obj.type) {
+				case 'session':
+					sessionStorage.setItem(resumeKey, obj.data);
+					break;
+				case 'terminal':
+					addTerminal(obj.terminal);
+					break;
+				case 'rejected':
+					if (resuming) {
+						// the session is gone, start a new one
+						sessionStorage.removeItem(resumeKey);
+						socket.onclose = function (event) {
+							connect();
+						};
+						break;
+					}
+					// fall through
+				case 'closed':
+					if (obj.type === 'closed') {
+						if (obj.terminal) {
+							removeTerminal(obj.terminal);
+						} else if (opening > 0) {
+							// a shell could not be opened
+							opening--;
+						}
+						if (!obj.data) {
+							// a replay seeking back closes its shells silently
+							break;
+						}
+					}
+					// fall through
+				case 'expiring':
+				case 'expired':
+				case 'shutdown':
+				case 'ports':
+				case 'queue':
+					// show session notices in yellow on their own line
+					term.write('\r\n\x1b[33m' + obj.data + '\x1b[0m\r\n');
+					break;
+				case 'replay':
+				case 'spectate':
+					// read-only notices go below the terminal so they do not mix
+					// with the output
+					$('#status').text(obj.data);
+					break;
+				case 'resize':
+					// replays and spectators follow the size of the recorded
+					// or watched terminal
+					if (!obj.terminal) {
+						term.resize(obj.width, obj.height);
+					} else if (terminals[obj.terminal]) {
+						terminals[obj.terminal].term.resize(obj.width, obj.height);
+					}
+					break;
+				default:
+					if (!obj.terminal) {
+						term.write(obj.data);
+					} else if (terminals[obj.terminal]) {
+						terminals[obj.terminal].term.write(obj.data);
+					}
+				}
+			};
+
+			socket.onclose = function (event) {
+				// reconnect to the session when the connection was lost,
+				// the server keeps it for a while
+				if (event.code === 1006 && sessionStorage.getItem(resumeKey) && resumeAttempts < maxResumeAttempts) {
+					resumeAttempts++;
+					term.write('\r\n\x1b[33mConnection lost, reconnecting...\x1b[0m\r\n');
+					setTimeout(connect, 1000 * Math.pow(2, resumeAttempts - 1));
+					return;
+				}
+				// the session ended, was rejected or was resumed in another tab
+				if (event.code !== 1006) {
+					sessionStorage.removeItem(resumeKey);
+				}
+				$.each(terminals, function(id, t) {
+					t.term.destroy();
+				});
+				term.destroy()
+			};
 		};
+		connect();
 
 		window.onresize = function(event) {
-			windowSize(term, socket);
+			if (readOnly) {
+				return;
+			}
+			windowSize(active ? terminals[active].term : term, socket, active);
 		};
 	};
 }).call(this);
@@ -1,19 +1,21 @@
 package main
 
 import (
+	"bytes"
 	"context"
-	"crypto/tls"
 	"crypto/x509"
+	"errors"
 	"flag"
 	"fmt"
 	"html/template"
 	"io/ioutil"
 	"net/http"
-	"net/url"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"syscall"
+	"time"
 
-	"github.com/docker/docker/client"
 	"github.com/genuinetools/contained.af/version"
 	"github.com/genuinetools/pkg/cli"
 	"github.com/sirupsen/logrus"
@@ -24,6 +26,8 @@ const (
 	defaultDockerHost       = "http://127.0.0.1:2375"
 	defaultDockerUserNSHost = "http://127.0.0.1:2376"
 	defaultDockerImage      = "alpine:latest"
+	defaultProfilesDir      = "/etc/contained.af/profiles"
+	defaultInstanceIDFile   = "/var/lib/contained.af/instance-id"
 )
 
 var (
@@ -33,8 +37,39 @@ var (
 	dockerCert       string
 	dockerKey        string
 
-	staticDir string
-	port      string
+	dockerUserNSCACert string
+	dockerUserNSCert   string
+	dockerUserNSKey    string
+	dockerUserNSTLS    bool
+
+	staticDir   string
+	profilesDir string
+	port        string
+	portRange   string
+	adminAddr   string
+	maxSessions int
+
+	sessionRate       float64
+	sessionBurst      int
+	maxClientSessions int
+
+	tokenSecretFile string
+	reviewers       string
+
+	recordingsDir      string
+	recordingMaxSize   string
+	recordingRetention time.Duration
+
+	tlsCert     string
+	tlsKey      string
+	tlsClientCA string
+
+	reapInterval       time.Duration
+	instanceID         string
+	instanceIDFile     string
+	shutdownGrace      time.Duration
+	resumeGrace        time.Duration
+	certReloadInterval time.Duration
 
 	debug  bool
 	tls_ws bool
@@ -51,6 +86,13 @@ func main() {
 	p.GitCommit = version.GITCOMMIT
 	p.Version = version.VERSION
 
+	// Setup the subcommands.
+	p.Commands = []cli.Command{
+		&seccompCommand{},
+		&tokenCommand{},
+		&certsCommand{},
+	}
+
 	// Setup the global flags.
 	p.FlagSet = flag.NewFlagSet("global", flag.ExitOnError)
 	p.FlagSet.StringVar(&dockerHost, "dhost", defaultDockerHost, "host to commmunicate with docker on")
@@ -58,13 +100,39 @@ func main() {
 	p.FlagSet.StringVar(&dockerCACert, "dcacert", "", "trust certs signed only by this CA for docker host")
 	p.FlagSet.StringVar(&dockerCert, "dcert", "", "path to TLS certificate file for docker host")
 	p.FlagSet.StringVar(&dockerKey, "dkey", "", "path to TLS key file for docker host")
+	p.FlagSet.StringVar(&dockerUserNSCACert, "dusernscacert", "", "trust certs signed only by this CA for user namespace enabled docker host (default: -dcacert)")
+	p.FlagSet.StringVar(&dockerUserNSCert, "dusernscert", "", "path to TLS certificate file for user namespace enabled docker host (default: -dcert)")
+	p.FlagSet.StringVar(&dockerUserNSKey, "dusernskey", "", "path to TLS key file for user namespace enabled docker host (default: -dkey)")
+	p.FlagSet.BoolVar(&dockerUserNSTLS, "dusernstls", false, "enable TLS for user namespace enabled docker host (default: -tlsws)")
+	p.FlagSet.DurationVar(&certReloadInterval, "dcert-reload", time.Minute, "how often to check the docker TLS files for changes, 0 to never reload them")
 	p.FlagSet.StringVar(&hostOS, "os", "", "operating system of the docker host")
 
 	p.FlagSet.StringVar(&staticDir, "frontend", defaultStaticDir, "directory that holds the static frontend files")
+	p.FlagSet.StringVar(&profilesDir, "profiles", defaultProfilesDir, "directory that holds the docker profile definitions")
 	p.FlagSet.StringVar(&port, "port", "10000", "port for server")
+	p.FlagSet.StringVar(&portRange, "container-ports", defaultPortRange, "range of host ports to publish container ports on")
+	p.FlagSet.StringVar(&adminAddr, "admin-addr", "127.0.0.1:10001", "address for the admin server, empty to disable it")
+	p.FlagSet.Float64Var(&sessionRate, "session-rate", 6, "sessions a client can start per minute, 0 for no limit")
+	p.FlagSet.IntVar(&sessionBurst, "session-burst", 3, "sessions a client can start at once before being rate limited")
+	p.FlagSet.IntVar(&maxClientSessions, "max-client-sessions", 2, "maximum number of concurrent sessions per client, 0 for no limit")
+	p.FlagSet.StringVar(&tlsCert, "tls-cert", "", "path to TLS certificate file to serve HTTPS with")
+	p.FlagSet.StringVar(&tlsKey, "tls-key", "", "path to TLS key file to serve HTTPS with")
+	p.FlagSet.StringVar(&tlsClientCA, "tls-client-ca", "", "require client certificates signed by this CA, their common name is the researcher ID")
+	p.FlagSet.StringVar(&tokenSecretFile, "token-secret", "", "file holding the secret access tokens are signed with, empty to disable authentication")
+	p.FlagSet.StringVar(&reviewers, "reviewers", "", "comma separated IDs of the researchers who may replay the sessions of the others")
+	p.FlagSet.StringVar(&recordingsDir, "recordings", "", "directory to record the sessions in, empty to not record them")
+	p.FlagSet.StringVar(&recordingMaxSize, "recording-max-size", "50m", "size at which a session recording is stopped, 0 for no limit")
+	p.FlagSet.DurationVar(&recordingRetention, "recording-retention", 90*24*time.Hour, "how long to keep session recordings, 0 to keep them forever")
+	p.FlagSet.IntVar(&maxSessions, "max-sessions", 0, "maximum number of concurrent sessions, the others wait in a queue, 0 for no limit")
+
+	p.FlagSet.StringVar(&instanceID, "instance-id", "", "ID of this server in the labels of its containers, only its own containers are reaped (default: read from -instance-id-file)")
+	p.FlagSet.StringVar(&instanceIDFile, "instance-id-file", defaultInstanceIDFile, "file to keep the generated instance ID in when -instance-id is not given, must persist across restarts")
+	p.FlagSet.DurationVar(&reapInterval, "reap-interval", 5*time.Minute, "how often to remove containers without a live session, 0 to only do it at startup")
+	p.FlagSet.DurationVar(&resumeGrace, "resume-grace", 2*time.Minute, "how long to keep a session after its browser went away for the browser to resume it, 0 to end it at once")
+	p.FlagSet.DurationVar(&shutdownGrace, "shutdown-grace", 30*time.Second, "how long to let sessions end on their own on shutdown before removing their containers")
 
 	p.FlagSet.BoolVar(&debug, "d", false, "enable debug logging")
-	p.FlagSet.BoolVar(&tls_ws, "tlsws", false, "enable TLS for container websocket")
+	p.FlagSet.BoolVar(&tls_ws, "tlsws", false, "enable TLS for docker host")
 
 	// Set the before function.
 	p.Before = func(ctx context.Context) error {
@@ -73,101 +141,210 @@ func main() {
 			logrus.SetLevel(logrus.DebugLevel)
 		}
 
+		if (tlsCert == "") != (tlsKey == "") {
+			return errors.New("-tls-cert and -tls-key must be passed together")
+		}
+		if tlsClientCA != "" && tlsCert == "" {
+			return errors.New("-tls-client-ca needs -tls-cert and -tls-key")
+		}
+
 		return nil
 	}
 
 	// Set the main program action.
 	p.Action = func(ctx context.Context, args []string) error {
-		if err := renderIndexPage(hostOS); err != nil {
+		profiles, err := loadProfiles(profilesDir)
+		if err != nil {
+			logrus.Fatalf("loading profiles: %v", err)
+		}
+
+		// a restarted server keeps its ID, so it reaps the containers its
+		// previous run left behind
+		if instanceID == "" {
+			instanceID, err = loadInstanceID(instanceIDFile)
+			if err != nil {
+				logrus.Fatal(err)
+			}
+		}
+
+		// the user namespace enabled daemon uses the TLS settings of the
+		// other one unless given its own
+		set := map[string]bool{}
+		p.FlagSet.Visit(func(f *flag.Flag) { set[f.Name] = true })
+		if !set["dusernstls"] {
+			dockerUserNSTLS = tls_ws
+		}
+		if !set["dusernscacert"] {
+			dockerUserNSCACert = dockerCACert
+		}
+		if !set["dusernscert"] && !set["dusernskey"] {
+			dockerUserNSCert = dockerCert
+			dockerUserNSKey = dockerKey
+		}
+
+		docker, err := dockerDaemon{
+			name:     "docker daemon",
+			host:     dockerHost,
+			tls:      tls_ws,
+			caFile:   dockerCACert,
+			certFile: dockerCert,
+			keyFile:  dockerKey,
+		}.connect(certReloadInterval)
+		if err != nil {
 			logrus.Fatal(err)
 		}
 
-		dockerURL, err := url.Parse(dockerHost)
+		dockerUserNS, err := dockerDaemon{
+			name:     "user namespace enabled docker daemon",
+			host:     dockerUserNSHost,
+			tls:      dockerUserNSTLS,
+			caFile:   dockerUserNSCACert,
+			certFile: dockerUserNSCert,
+			keyFile:  dockerUserNSKey,
+		}.connect(certReloadInterval)
 		if err != nil {
-			logrus.Fatalf("parsing docker daemon URL: %v", err)
+			logrus.Fatal(err)
 		}
 
-		dockerUserNSURL, err := url.Parse(dockerUserNSHost)
+		ports, err := newPortAllocator(portRange)
 		if err != nil {
-			logrus.Fatalf("parsing user namespace enabled docker daemon URL: %v", err)
+			logrus.Fatal(err)
 		}
 
-		// setup client TLS
-		tlsConfig := tls.Config{
-			// Prefer TLS1.2 as the client minimum
-			MinVersion: tls.VersionTLS12,
-			CipherSuites: []uint16{
-				tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
-				tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
-			},
-			InsecureSkipVerify: false,
+		rateLimiter, err := newRateLimiter(sessionRate, sessionBurst)
+		if err != nil {
+			logrus.Fatal(err)
 		}
 
-		if dockerCACert != "" {
-			CAs, err := certPool(dockerCACert)
+		var tokenSecret []byte
+		if tokenSecretFile != "" {
+			tokenSecret, err = loadTokenSecret(tokenSecretFile)
 			if err != nil {
 				logrus.Fatal(err)
 			}
-			tlsConfig.RootCAs = CAs
+		} else {
+			logrus.Warn("no -token-secret given, anyone can start sessions")
 		}
 
-		c := &http.Client{
-			Transport: &http.Transport{},
-		}
-		if tls_ws {
-			c = &http.Client{
-				Transport: &http.Transport{
-					TLSClientConfig: &tlsConfig,
-				},
-			}
+		reviewerIDs, err := parseReviewers(reviewers)
+		if err != nil {
+			logrus.Fatal(err)
 		}
 
-		if dockerCert != "" && dockerKey != "" {
-			tlsCert, err := tls.LoadX509KeyPair(dockerCert, dockerKey)
+		var recorder *recorder
+		if recordingsDir != "" {
+			recorder, err = newRecorder(recordingsDir, recordingMaxSize, recordingRetention)
 			if err != nil {
-				logrus.Fatalf("Could not load X509 key pair: %v. Make sure the key is not encrypted", err)
+				logrus.Fatal(err)
 			}
-			tlsConfig.Certificates = []tls.Certificate{tlsCert}
+		} else {
+			logrus.Warn("no -recordings directory given, sessions are not recorded")
 		}
 
-		defaultHeaders := map[string]string{"User-Agent": "engine-api-cli-1.0"}
-		dcli, err := client.NewClient(dockerHost, "", c, defaultHeaders)
-		if err != nil {
-			logrus.Fatalf("creating docker client: %v", err)
+		h := &handler{
+			docker:       docker,
+			dockerUserNS: dockerUserNS,
+
+			profiles:    profiles,
+			profilesDir: profilesDir,
+			hostOS:      hostOS,
+
+			instanceID: instanceID,
+			sessions:   map[string]*containerInfo{},
+
+			ports:             ports,
+			limiter:           newSessionLimiter(maxSessions),
+			rateLimiter:       rateLimiter,
+			maxClientSessions: maxClientSessions,
+			tokenSecret:       tokenSecret,
+			recorder:          recorder,
+			reviewers:         reviewerIDs,
+			resumeGrace:       resumeGrace,
 		}
 
-		dockerUserNSCLI, err := client.NewClient(dockerUserNSHost, "", c, defaultHeaders)
-		if err != nil {
-			logrus.Fatalf("creating user namespace enabled docker client: %v", err)
+		// negotiate the API version before anything else uses the client,
+		// the user namespace enabled daemon is only needed by the sessions
+		// using it and is negotiated with on first use if it is down
+		if err := h.negotiate(false, negotiateAttempts, negotiateDelay); err != nil {
+			logrus.Fatal(err)
 		}
 
-		h := &handler{
-			dcli:      dcli,
-			dockerURL: dockerURL,
-			tlsConfig: &tlsConfig,
+		// only offer the profiles the daemons can run
+		h.profiles = h.supportedProfiles(profiles)
+		if len(h.profiles) == 0 {
+			logrus.Fatal("the docker daemons cannot run any of the profiles")
+		}
+		if err := renderIndexPage(hostOS, profileNames(h.profiles), tokenSecretFile != ""); err != nil {
+			logrus.Fatal(err)
+		}
 
-			dUserNSCli:      dockerUserNSCLI,
-			dockerUserNSURL: dockerUserNSURL,
-			tls_ws:          tls_ws,
+		// remove containers left behind by previous runs
+		go h.reapLoop(reapInterval)
+
+		// remove recordings past their retention
+		go recorder.pruneLoop()
+
+		// reload profiles on SIGHUP
+		go h.reloadOnSignal()
+
+		// admin endpoints are served on their own address so they are not
+		// reachable by researchers
+		if adminAddr != "" {
+			adminMux := http.NewServeMux()
+			adminMux.HandleFunc("/reload", h.reloadHandler)
+			go func() {
+				logrus.Debugf("Admin server listening on %s", adminAddr)
+				if err := http.ListenAndServe(adminAddr, adminMux); err != nil {
+					logrus.Fatalf("starting admin server failed: %v", err)
+				}
+			}()
 		}
 
 		// ping handler
 		http.HandleFunc("/ping", pingHandler)
 
 		// info handler
-		http.HandleFunc("/info", h.infoHandler)
-		http.HandleFunc("/info-userns", h.infoUserNSHandler)
+		http.HandleFunc("/info", h.requireAuth(h.infoHandler))
+		http.HandleFunc("/info-userns", h.requireAuth(h.infoUserNSHandler))
 
 		// select profiles and websocket handling
 		http.HandleFunc("/profiles", h.profilesHandler)
 
+		// replay of recorded sessions
+		http.HandleFunc("/replay", h.replayHandler)
+
+		// read-only view of live sessions
+		http.HandleFunc("/spectate", h.spectateHandler)
+
 		// static files
 		http.Handle("/", http.FileServer(http.Dir(staticDir)))
 
-		logrus.Debugf("Server listening on %s", port)
-		if err := http.ListenAndServe(":"+port, nil); err != nil {
-			logrus.Fatalf("starting server failed: %v", err)
+		srv := &http.Server{Addr: ":" + port}
+		if tlsCert != "" {
+			srv.TLSConfig, err = serverTLSConfig(tlsClientCA)
+			if err != nil {
+				logrus.Fatal(err)
+			}
 		}
+		go func() {
+			logrus.Debugf("Server listening on %s", port)
+			var err error
+			if tlsCert != "" {
+				err = srv.ListenAndServeTLS(tlsCert, tlsKey)
+			} else {
+				err = srv.ListenAndServe()
+			}
+			if err != nil && err != http.ErrServerClosed {
+				logrus.Fatalf("starting server failed: %v", err)
+			}
+		}()
+
+		// drain the sessions and remove their containers on shutdown
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		sig := <-signals
+		logrus.Infof("received %s, shutting down within %s", sig, shutdownGrace)
+		h.shutdown(srv, shutdownGrace)
 		return nil
 	}
 
@@ -175,26 +352,56 @@ func main() {
 	p.Run()
 }
 
-func renderIndexPage(hostOS string) error {
+func renderIndexPage(hostOS string, profiles []string, auth bool) error {
 	tmplData := struct {
 		OperatingSystem string
+		Profiles        []string
+		Auth            bool
 	}{
 		OperatingSystem: hostOS,
+		Profiles:        profiles,
+		Auth:            auth,
 	}
 
-	tmpl, err := template.ParseFiles(filepath.Join(defaultStaticDir, "index-template.html"))
+	tmpl, err := template.ParseFiles(filepath.Join(staticDir, "index-template.html"))
 	if err != nil {
 		// should be caught in development time and not fail at runtime
 		return fmt.Errorf("static template parsing failed, %v", err)
 	}
 
-	indexFile, err := os.Create(filepath.Join(defaultStaticDir, "index.html"))
-	if err != nil {
+	var index bytes.Buffer
+	if err = tmpl.Execute(&index, tmplData); err != nil {
+		return fmt.Errorf("executing template: %v", err)
+	}
+
+	// replace the page at once, it may be served while profiles are reloaded
+	if err := writeFileAtomic(filepath.Join(staticDir, "index.html"), index.Bytes(), 0644); err != nil {
 		return fmt.Errorf("could not create index.html, %v", err)
 	}
+	return nil
+}
 
-	if err = tmpl.Execute(indexFile, tmplData); err != nil {
-		return fmt.Errorf("executing template: %v", err)
+// writeFileAtomic replaces file with b, so readers never see a partially
+// written file.
+func writeFileAtomic(file string, b []byte, mode os.FileMode) error {
+	f, err := ioutil.TempFile(filepath.Dir(file), "."+filepath.Base(file))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return fmt.Errorf("writing %s: %v", file, err)
+	}
+	if err := f.Chmod(mode); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(f.Name(), file); err != nil {
+		return fmt.Errorf("writing %s: %v", file, err)
 	}
 	return nil
 }
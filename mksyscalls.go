@@ -0,0 +1,103 @@
+//go:build ignore
+// +build ignore
+
+// mksyscalls generates seccomp-syscalls.go, the per-architecture syscall
+// tables seccomp profiles are validated against, from the syscall numbers
+// in the vendored golang.org/x/sys/unix package.
+//
+// Run it with: go generate
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const unixDir = "vendor/golang.org/x/sys/unix"
+
+var (
+	fileRe    = regexp.MustCompile(`zsysnum_linux_([a-z0-9]+)\.go$`)
+	syscallRe = regexp.MustCompile(`(?m)^\s*SYS_([A-Z0-9_]+)\s*=\s*\d+`)
+)
+
+// extra holds architecture private syscalls that libseccomp knows about but
+// are not part of the generic syscall numbers.
+var extra = map[string][]string{
+	"arm": {"arm_sync_file_range", "breakpoint", "cacheflush", "set_tls", "sync_file_range2", "usr26", "usr32"},
+}
+
+func main() {
+	files, err := filepath.Glob(filepath.Join(unixDir, "zsysnum_linux_*.go"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	tables := map[string][]string{}
+	for _, file := range files {
+		arch := fileRe.FindStringSubmatch(file)[1]
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			log.Fatal(err)
+		}
+		seen := map[string]bool{}
+		for _, m := range syscallRe.FindAllStringSubmatch(string(b), -1) {
+			seen[strings.ToLower(m[1])] = true
+		}
+		for _, name := range extra[arch] {
+			seen[name] = true
+		}
+		for name := range seen {
+			tables[arch] = append(tables[arch], name)
+		}
+		sort.Strings(tables[arch])
+	}
+
+	arches := make([]string, 0, len(tables))
+	for arch := range tables {
+		arches = append(arches, arch)
+	}
+	sort.Strings(arches)
+
+	var buf bytes.Buffer
+	fmt.Fprintln(&buf, "// Code generated by go run mksyscalls.go; DO NOT EDIT.")
+	fmt.Fprintln(&buf)
+	fmt.Fprintln(&buf, "package main")
+	fmt.Fprintln(&buf)
+	fmt.Fprintln(&buf, "// syscallNames holds the space separated syscall names of every")
+	fmt.Fprintln(&buf, "// architecture, keyed by GOARCH.")
+	fmt.Fprintln(&buf, "var syscallNames = map[string]string{")
+	for _, arch := range arches {
+		fmt.Fprintf(&buf, "%q: `", arch)
+		line := 0
+		for i, name := range tables[arch] {
+			if i > 0 {
+				if line+len(name) > 72 {
+					buf.WriteString("\n")
+					line = 0
+				} else {
+					buf.WriteString(" ")
+					line++
+				}
+			}
+			buf.WriteString(name)
+			line += len(name)
+		}
+		buf.WriteString("`,\n")
+	}
+	fmt.Fprintln(&buf, "}")
+
+	out, err := format.Source(buf.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := ioutil.WriteFile("seccomp-syscalls.go", out, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/docker/go-connections/nat"
+)
+
+// defaultPortRange is the allowed range of open ports defined in terraform config
+// https://github.com/kinvolk/container-escape-bounty/pull/19
+const defaultPortRange = "36100-36110"
+
+// portAllocator leases host ports from a range to sessions, so two sessions
+// never ask docker for the same port.
+type portAllocator struct {
+	min, max int
+
+	mu sync.Mutex
+	// leases maps every leased port to the session holding it.
+	leases map[nat.Port]string
+}
+
+// newPortAllocator returns an allocator for the ports in portRange, written
+// like "36100-36110".
+func newPortAllocator(portRange string) (*portAllocator, error) {
+	min, max, err := nat.ParsePortRangeToInt(portRange)
+	if err != nil {
+		return nil, fmt.Errorf("parsing port range %q: %v", portRange, err)
+	}
+	return &portAllocator{
+		min:    min,
+		max:    max,
+		leases: map[nat.Port]string{},
+	}, nil
+}
+
+// lease reserves a free port for every protocol in protos for session. It
+// either leases all the ports or none of them.
+func (a *portAllocator) lease(session string, protos []string) ([]nat.Port, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var ports []nat.Port
+	for _, proto := range protos {
+		port, ok := a.free(proto)
+		if !ok {
+			for _, p := range ports {
+				delete(a.leases, p)
+			}
+			return nil, fmt.Errorf("no free %s port left in [%d, %d], try again later", proto, a.min, a.max)
+		}
+		a.leases[port] = session
+		ports = append(ports, port)
+	}
+	return ports, nil
+}
+
+// free returns the lowest port for proto that is not leased. The caller must
+// hold a.mu.
+func (a *portAllocator) free(proto string) (nat.Port, bool) {
+	for i := a.min; i <= a.max; i++ {
+		port := nat.Port(strconv.Itoa(i) + "/" + proto)
+		if _, ok := a.leases[port]; !ok {
+			return port, true
+		}
+	}
+	return "", false
+}
+
+// release returns the ports leased to session to the pool.
+func (a *portAllocator) release(session string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for port, s := range a.leases {
+		if s == session {
+			delete(a.leases, port)
+		}
+	}
+}
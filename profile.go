@@ -0,0 +1,282 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/mount"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// profileExt is the file extension of the profile definitions in the
+	// profiles directory.
+	profileExt = ".json"
+
+	// defaultWarnBefore is how long before a session expires the browser is
+	// warned when a profile does not say otherwise.
+	defaultWarnBefore = time.Minute
+)
+
+// profile is an abstraction to support different configuration sets for running
+// containers. More information is available here about the supported profiles and their meanings:
+// https://github.com/kinvolk/container-escape-bounty/blob/master/Documentation/profiles.md
+//
+// Profiles are declared in JSON files, one per profile, in the profiles
+// directory. The name of a profile is its file name without the extension.
+type profile struct {
+	Name        string         `json:"-"`
+	Description string         `json:"description,omitempty"`
+	User        string         `json:"user"`
+	CapAdd      []string       `json:"capAdd,omitempty"`
+	CapDrop     []string       `json:"capDrop,omitempty"`
+	Mounts      []profileMount `json:"mounts,omitempty"`
+	Ports       []string       `json:"ports,omitempty"`
+	Seccomp     string         `json:"seccomp"`
+	SecurityOpt []string       `json:"securityOpt,omitempty"`
+	// Runtime is the OCI runtime containers run with, like runsc, the
+	// default runtime of the daemon when empty.
+	Runtime   string           `json:"runtime,omitempty"`
+	Resources profileResources `json:"resources"`
+	Session   profileSession   `json:"session"`
+
+	// seccomp is the parsed seccomp profile Seccomp refers to and
+	// seccompJSON its encoding passed to the docker daemon.
+	seccomp     *seccompProfile
+	seccompJSON []byte
+}
+
+// defaultPorts are the protocols of the ports opened for a session when the
+// profile does not list any.
+var defaultPorts = []string{"tcp"}
+
+// profileMount is a mount from the host into the container.
+type profileMount struct {
+	Type     mount.Type `json:"type"`
+	Source   string     `json:"source,omitempty"`
+	Target   string     `json:"target"`
+	ReadOnly bool       `json:"readOnly,omitempty"`
+}
+
+// profileSession holds the limits of the sessions started with a profile.
+type profileSession struct {
+	// MaxLifetime is how long a session can last, zero means forever.
+	MaxLifetime duration `json:"maxLifetime,omitempty"`
+	// IdleTimeout is how long a session can go without any input from the
+	// browser, zero means forever.
+	IdleTimeout duration `json:"idleTimeout,omitempty"`
+	// WarnBefore is how long before a session expires the browser starts
+	// to be warned, defaults to defaultWarnBefore.
+	WarnBefore duration `json:"warnBefore,omitempty"`
+	// MaxConcurrent is how many sessions with the profile can run at once,
+	// zero means no limit other than the global one.
+	MaxConcurrent int `json:"maxConcurrent,omitempty"`
+}
+
+// duration is a time.Duration written as a string like "1h30m" in profiles.
+type duration struct {
+	time.Duration
+}
+
+func (d *duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"1h30m\": %v", err)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = v
+	return nil
+}
+
+func (d duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// capabilities holds all the capabilities that can be added to or dropped
+// from a container, without the "CAP_" prefix.
+var capabilities = map[string]struct{}{
+	"ALL":              {},
+	"AUDIT_CONTROL":    {},
+	"AUDIT_READ":       {},
+	"AUDIT_WRITE":      {},
+	"BLOCK_SUSPEND":    {},
+	"CHOWN":            {},
+	"DAC_OVERRIDE":     {},
+	"DAC_READ_SEARCH":  {},
+	"FOWNER":           {},
+	"FSETID":           {},
+	"IPC_LOCK":         {},
+	"IPC_OWNER":        {},
+	"KILL":             {},
+	"LEASE":            {},
+	"LINUX_IMMUTABLE":  {},
+	"MAC_ADMIN":        {},
+	"MAC_OVERRIDE":     {},
+	"MKNOD":            {},
+	"NET_ADMIN":        {},
+	"NET_BIND_SERVICE": {},
+	"NET_BROADCAST":    {},
+	"NET_RAW":          {},
+	"SETFCAP":          {},
+	"SETGID":           {},
+	"SETPCAP":          {},
+	"SETUID":           {},
+	"SYSLOG":           {},
+	"SYS_ADMIN":        {},
+	"SYS_BOOT":         {},
+	"SYS_CHROOT":       {},
+	"SYS_MODULE":       {},
+	"SYS_NICE":         {},
+	"SYS_PACCT":        {},
+	"SYS_PTRACE":       {},
+	"SYS_RAWIO":        {},
+	"SYS_RESOURCE":     {},
+	"SYS_TIME":         {},
+	"SYS_TTY_CONFIG":   {},
+	"WAKE_ALARM":       {},
+}
+
+// loadProfiles parses and validates every profile in dir.
+func loadProfiles(dir string) (map[string]*profile, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*"+profileExt))
+	if err != nil {
+		return nil, fmt.Errorf("listing profiles in %s: %v", dir, err)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no profiles found in %s", dir)
+	}
+
+	profiles := make(map[string]*profile, len(files))
+	for _, file := range files {
+		p, err := loadProfile(file)
+		if err != nil {
+			return nil, err
+		}
+		profiles[p.Name] = p
+		logrus.Debugf("loaded profile %q from %s", p.Name, file)
+	}
+
+	return profiles, nil
+}
+
+// loadProfile parses and validates a single profile file.
+func loadProfile(file string) (*profile, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("opening profile: %v", err)
+	}
+	defer f.Close()
+
+	var p profile
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&p); err != nil {
+		return nil, fmt.Errorf("parsing profile %s: %v", file, err)
+	}
+	p.Name = strings.TrimSuffix(filepath.Base(file), profileExt)
+
+	if err := p.validate(); err != nil {
+		return nil, fmt.Errorf("invalid profile %s: %v", file, err)
+	}
+
+	p.seccomp, err = loadSeccomp(p.Seccomp, filepath.Dir(file))
+	if err != nil {
+		return nil, fmt.Errorf("invalid profile %s: %v", file, err)
+	}
+	p.seccompJSON, err = json.Marshal(p.seccomp)
+	if err != nil {
+		return nil, fmt.Errorf("encoding seccomp profile for %s: %v", file, err)
+	}
+
+	if err := p.Resources.parse(); err != nil {
+		return nil, fmt.Errorf("invalid profile %s: resources: %v", file, err)
+	}
+	if len(p.Ports) == 0 {
+		p.Ports = defaultPorts
+	}
+	if p.Session.WarnBefore.Duration == 0 {
+		p.Session.WarnBefore.Duration = defaultWarnBefore
+	}
+
+	return &p, nil
+}
+
+// validate checks the fields of a profile that can be checked on their own.
+func (p *profile) validate() error {
+	for _, c := range append(append([]string{}, p.CapAdd...), p.CapDrop...) {
+		if _, ok := capabilities[strings.TrimPrefix(strings.ToUpper(c), "CAP_")]; !ok {
+			return fmt.Errorf("unknown capability %q", c)
+		}
+	}
+
+	for _, m := range p.Mounts {
+		if !filepath.IsAbs(m.Target) {
+			return fmt.Errorf("mount target %q must be an absolute path", m.Target)
+		}
+		switch m.Type {
+		case mount.TypeBind:
+			if !filepath.IsAbs(m.Source) {
+				return fmt.Errorf("bind mount source %q must be an absolute path", m.Source)
+			}
+		case mount.TypeVolume:
+		case mount.TypeTmpfs:
+			if m.Source != "" {
+				return fmt.Errorf("tmpfs mount on %q cannot have a source", m.Target)
+			}
+		default:
+			return fmt.Errorf("unsupported mount type %q for %q", m.Type, m.Target)
+		}
+	}
+
+	for _, proto := range p.Ports {
+		if proto != "tcp" && proto != "udp" {
+			return fmt.Errorf("unsupported port protocol %q, must be tcp or udp", proto)
+		}
+	}
+
+	if p.Seccomp == "" {
+		return fmt.Errorf("seccomp profile is required")
+	}
+
+	for _, opt := range p.SecurityOpt {
+		// seccomp, SELinux and AppArmor are set up by withSecurityOptions.
+		for _, prefix := range []string{"seccomp", "label", "apparmor"} {
+			if strings.HasPrefix(opt, prefix+"=") || strings.HasPrefix(opt, prefix+":") {
+				return fmt.Errorf("security option %q cannot be set in a profile", opt)
+			}
+		}
+	}
+
+	for field, d := range map[string]duration{
+		"maxLifetime": p.Session.MaxLifetime,
+		"idleTimeout": p.Session.IdleTimeout,
+		"warnBefore":  p.Session.WarnBefore,
+	} {
+		if d.Duration < 0 {
+			return fmt.Errorf("session %s cannot be negative, given: %s", field, d)
+		}
+	}
+	if p.Session.MaxConcurrent < 0 {
+		return fmt.Errorf("session maxConcurrent cannot be negative, given: %d", p.Session.MaxConcurrent)
+	}
+
+	return nil
+}
+
+// profileNames returns the sorted names of profiles.
+func profileNames(profiles map[string]*profile) []string {
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// queueUpdateInterval is how often waiting browsers are told their position
+// in the queue.
+const queueUpdateInterval = 5 * time.Second
+
+// sessionLimiter caps the number of concurrent sessions, globally and per
+// profile, and queues the sessions that do not fit in first come, first
+// served order.
+type sessionLimiter struct {
+	// max is the global limit, zero means unlimited.
+	max int
+
+	mu         sync.Mutex
+	active     int
+	perProfile map[string]int
+	queue      []*sessionSlot
+}
+
+// sessionSlot is the place of a session in the limiter, either waiting in
+// the queue or holding a slot.
+type sessionSlot struct {
+	profile *profile
+	// ready is closed once the slot is granted.
+	ready   chan struct{}
+	granted bool
+}
+
+func newSessionLimiter(max int) *sessionLimiter {
+	return &sessionLimiter{
+		max:        max,
+		perProfile: map[string]int{},
+	}
+}
+
+// enqueue adds a session with profile p to the queue and grants it a slot
+// right away if there is capacity.
+func (l *sessionLimiter) enqueue(p *profile) *sessionSlot {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	s := &sessionSlot{profile: p, ready: make(chan struct{})}
+	l.queue = append(l.queue, s)
+	l.dispatch()
+	return s
+}
+
+// fits returns whether a session with profile p can start. The caller must
+// hold l.mu.
+func (l *sessionLimiter) fits(p *profile) bool {
+	if l.max > 0 && l.active >= l.max {
+		return false
+	}
+	max := p.Session.MaxConcurrent
+	return max <= 0 || l.perProfile[p.Name] < max
+}
+
+// dispatch grants slots to the queued sessions in order, skipping the ones
+// whose profile is at its limit. The caller must hold l.mu.
+func (l *sessionLimiter) dispatch() {
+	queue := l.queue[:0]
+	for _, s := range l.queue {
+		if !l.fits(s.profile) {
+			queue = append(queue, s)
+			continue
+		}
+		l.active++
+		l.perProfile[s.profile.Name]++
+		s.granted = true
+		close(s.ready)
+	}
+	l.queue = queue
+}
+
+// release gives back the slot of a session, or takes it out of the queue if
+// it is still waiting. It is safe to call with a nil slot.
+func (l *sessionLimiter) release(s *sessionSlot) {
+	if s == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if s.granted {
+		s.granted = false
+		l.active--
+		l.perProfile[s.profile.Name]--
+	} else {
+		for i, queued := range l.queue {
+			if queued == s {
+				l.queue = append(l.queue[:i], l.queue[i+1:]...)
+				break
+			}
+		}
+	}
+	l.dispatch()
+}
+
+// position returns the 1-based position of a session in the queue, zero if
+// it is not waiting.
+func (l *sessionLimiter) position(s *sessionSlot) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i, queued := range l.queue {
+		if queued == s {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// waitForSlot waits until the queued session gets its slot, telling the
+// browser its position in the queue. msgs are the messages read from the
+// browser, input is dropped while waiting and the last resize is returned
+// to be applied once the container runs. It returns false if the browser
+// went away, the slot is given back by removeContainer.
+func (h *handler) waitForSlot(ctrInfo *containerInfo, conn *lockedConn, msgs <-chan message) (*message, bool) {
+	select {
+	case <-ctrInfo.slot.ready:
+		return nil, true
+	default:
+	}
+
+	notify := func() {
+		pos := h.limiter.position(ctrInfo.slot)
+		if pos == 0 {
+			return
+		}
+		if err := conn.WriteJSON(message{
+			Type: "queue",
+			Data: fmt.Sprintf("All slots are in use, you are number %d in the queue.", pos),
+		}); err != nil {
+			ctrInfo.logger().Errorf("writing queue message to browser websocket failed: %v", err)
+		}
+	}
+	ctrInfo.logger().Infof("queued at position %d", h.limiter.position(ctrInfo.slot))
+	notify()
+
+	var resize *message
+	ticker := time.NewTicker(queueUpdateInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctrInfo.slot.ready:
+			return resize, true
+		case data, ok := <-msgs:
+			if !ok {
+				return nil, false
+			}
+			if data.Type == "resize" {
+				resize = &data
+			}
+		case <-ticker.C:
+			notify()
+		}
+	}
+}
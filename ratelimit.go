@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/sirupsen/logrus"
+)
+
+// bucketIdle is how long a client must stay away before its token bucket is
+// forgotten, by then it is full again anyway.
+const bucketIdle = 10 * time.Minute
+
+// rateLimiter is a token bucket per client limiting how often sessions can
+// be started.
+type rateLimiter struct {
+	// rate is the number of tokens added per second, zero disables the
+	// limiter, and burst the size of the buckets.
+	rate  float64
+	burst int
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastPrune time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// newRateLimiter returns a limiter allowing perMinute sessions per client on
+// average, and up to burst at once.
+func newRateLimiter(perMinute float64, burst int) (*rateLimiter, error) {
+	if perMinute < 0 {
+		return nil, fmt.Errorf("session rate cannot be negative, given: %v", perMinute)
+	}
+	if burst < 1 {
+		return nil, fmt.Errorf("session burst must be at least 1, given: %d", burst)
+	}
+	return &rateLimiter{
+		rate:    perMinute / 60,
+		burst:   burst,
+		buckets: map[string]*tokenBucket{},
+	}, nil
+}
+
+// allow takes a token from the bucket of client and returns whether there
+// was one.
+func (l *rateLimiter) allow(client string) bool {
+	if l.rate == 0 {
+		return true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.prune(now)
+
+	b, ok := l.buckets[client]
+	if !ok {
+		b = &tokenBucket{tokens: float64(l.burst), last: now}
+		l.buckets[client] = b
+	}
+	b.tokens += now.Sub(b.last).Seconds() * l.rate
+	if b.tokens > float64(l.burst) {
+		b.tokens = float64(l.burst)
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// prune forgets the buckets of the clients that have been idle for
+// bucketIdle, at most once per bucketIdle. The caller must hold l.mu.
+func (l *rateLimiter) prune(now time.Time) {
+	if now.Sub(l.lastPrune) < bucketIdle {
+		return
+	}
+	l.lastPrune = now
+	for client, b := range l.buckets {
+		if now.Sub(b.last) >= bucketIdle {
+			delete(l.buckets, client)
+		}
+	}
+}
+
+// clientKey returns the key sessions from r are limited by, the researcher
+// when authenticated or else the IP address of the client.
+func clientKey(r *http.Request, researcher string) string {
+	if researcher != "" {
+		return "researcher:" + researcher
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return "ip:" + r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// rejectSession tells the browser why its session is not started and closes
+// the websocket with code.
+func rejectSession(conn *lockedConn, code int, reason string) {
+	if err := conn.WriteJSON(message{
+		Type: "rejected",
+		Data: reason,
+	}); err != nil {
+		logrus.Errorf("writing rejection message to browser websocket failed: %v", err)
+	}
+	if err := conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(code, "")); err != nil {
+		logrus.Errorf("closing browser websocket failed: %v", err)
+	}
+	conn.Close()
+}
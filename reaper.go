@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Labels set on every container we create, so containers left behind by a
+// crashed or restarted server can be found and removed.
+const (
+	labelPrefix     = "af.contained."
+	sessionLabel    = labelPrefix + "session"
+	profileLabel    = labelPrefix + "profile"
+	createdLabel    = labelPrefix + "created"
+	instanceLabel   = labelPrefix + "instance"
+	researcherLabel = labelPrefix + "researcher"
+)
+
+// newID returns a random hex encoded ID, used for sessions and server
+// instances.
+func newID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		// crypto/rand never fails on the platforms we support
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// loadInstanceID returns the instance ID kept in file, generating and
+// writing one the first time, so the server keeps its ID across restarts
+// and redeploys as long as file does.
+func loadInstanceID(file string) (string, error) {
+	b, err := ioutil.ReadFile(file)
+	if err == nil {
+		id := strings.TrimSpace(string(b))
+		if id == "" {
+			return "", fmt.Errorf("instance ID file %s is empty", file)
+		}
+		return id, nil
+	}
+	if !os.IsNotExist(err) {
+		return "", fmt.Errorf("reading instance ID file: %v", err)
+	}
+
+	id := newID()
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return "", fmt.Errorf("creating directory of instance ID file: %v", err)
+	}
+	if err := writeFileAtomic(file, []byte(id+"\n"), 0644); err != nil {
+		return "", fmt.Errorf("writing instance ID file: %v", err)
+	}
+	return id, nil
+}
+
+// trackSession records a live session, its container is not reaped. It
+// fails if the client of the session already has h.maxClientSessions live
+// sessions.
+func (h *handler) trackSession(ctrInfo *containerInfo) error {
+	h.sessionsMu.Lock()
+	defer h.sessionsMu.Unlock()
+	if h.sessions == nil {
+		h.sessions = map[string]*containerInfo{}
+	}
+	if h.maxClientSessions > 0 {
+		n := 0
+		for _, s := range h.sessions {
+			if s.client == ctrInfo.client {
+				n++
+			}
+		}
+		if n >= h.maxClientSessions {
+			return fmt.Errorf("You already have %d sessions running, end one before starting another.", n)
+		}
+	}
+	h.sessions[ctrInfo.sessionID] = ctrInfo
+	return nil
+}
+
+// untrackSession forgets a session once its container has been removed.
+func (h *handler) untrackSession(ctrInfo *containerInfo) {
+	h.sessionsMu.Lock()
+	defer h.sessionsMu.Unlock()
+	delete(h.sessions, ctrInfo.sessionID)
+}
+
+// isLiveSession returns whether the session with id is tracked.
+func (h *handler) isLiveSession(id string) bool {
+	h.sessionsMu.Lock()
+	defer h.sessionsMu.Unlock()
+	_, ok := h.sessions[id]
+	return ok
+}
+
+// reapLoop removes orphaned containers right away and then every interval.
+func (h *handler) reapLoop(interval time.Duration) {
+	h.reapOrphans()
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		h.reapOrphans()
+	}
+}
+
+// reapOrphans removes the containers on both docker daemons that were
+// created by this server instance but do not belong to a live session.
+// Containers of other instances sharing the daemons are left to them.
+func (h *handler) reapOrphans() {
+	for _, userns := range []bool{false, true} {
+		if err := h.ready(userns); err != nil {
+			logrus.Warnf("not reaping containers: %v", err)
+			continue
+		}
+		ctrs, err := h.backend(userns).List(context.Background(), instanceLabel+"="+h.instanceID)
+		if err != nil {
+			logrus.Errorf("listing containers to reap (userns: %t) failed: %v", userns, err)
+			continue
+		}
+
+		for _, ctr := range ctrs {
+			if h.isLiveSession(ctr.Labels[sessionLabel]) {
+				continue
+			}
+			if err := h.backend(userns).Remove(context.Background(), ctr.ID); err != nil {
+				logrus.Errorf("removing orphaned container %s failed: %v", ctr.ID, err)
+				continue
+			}
+			logrus.WithFields(logrus.Fields{
+				"session":    ctr.Labels[sessionLabel],
+				"researcher": ctr.Labels[researcherLabel],
+			}).Infof("removed orphaned container %s (profile: %s, created: %s, instance: %s)",
+				ctr.ID, ctr.Labels[profileLabel], ctr.Labels[createdLabel], ctr.Labels[instanceLabel])
+		}
+	}
+}
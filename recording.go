@@ -0,0 +1,278 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/go-units"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// recordingExt is the extension of session recordings.
+	recordingExt = ".cast"
+	// recordingPruneInterval is how often recordings past their retention
+	// are removed.
+	recordingPruneInterval = time.Hour
+	// default terminal size of a recording, until the browser sends its own.
+	recordingWidth  = 80
+	recordingHeight = 24
+)
+
+// recorder records sessions in asciicast v2 files named after their session
+// ID, see https://docs.asciinema.org/manual/asciicast/v2/.
+type recorder struct {
+	dir string
+	// maxSize caps the size of a recording, zero for no limit, and retention
+	// is how long recordings are kept, zero to keep them forever.
+	maxSize   int64
+	retention time.Duration
+}
+
+// newRecorder returns a recorder writing to dir, creating it if needed.
+// maxSize is a size like "50m".
+func newRecorder(dir, maxSize string, retention time.Duration) (*recorder, error) {
+	var max int64
+	if maxSize != "" && maxSize != "0" {
+		var err error
+		max, err = units.RAMInBytes(maxSize)
+		if err != nil {
+			return nil, fmt.Errorf("parsing recording size limit %q: %v", maxSize, err)
+		}
+	}
+	if retention < 0 {
+		return nil, fmt.Errorf("recording retention cannot be negative, given: %s", retention)
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("creating recordings directory: %v", err)
+	}
+	return &recorder{
+		dir:       dir,
+		maxSize:   max,
+		retention: retention,
+	}, nil
+}
+
+// castHeader is the first line of an asciicast v2 file.
+type castHeader struct {
+	Version   int               `json:"version"`
+	Width     uint              `json:"width"`
+	Height    uint              `json:"height"`
+	Timestamp int64             `json:"timestamp"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+
+	// Session and Researcher are not part of asciicast, players ignore
+	// them. They tell who may replay the recording.
+	Session    string `json:"session,omitempty"`
+	Researcher string `json:"researcher,omitempty"`
+}
+
+// recording is the recording of a session. Its methods can be called from
+// multiple goroutines, on a nil recording they do nothing.
+type recording struct {
+	log   *logrus.Entry
+	start time.Time
+
+	mu     sync.Mutex
+	f      *os.File
+	size   int64
+	max    int64
+	closed bool
+}
+
+// record starts recording the session of ctrInfo. It returns a nil
+// recording if r is nil, as recording is disabled then.
+func (r *recorder) record(ctrInfo *containerInfo) (*recording, error) {
+	if r == nil {
+		return nil, nil
+	}
+	f, err := os.OpenFile(filepath.Join(r.dir, ctrInfo.sessionID+recordingExt), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("creating recording: %v", err)
+	}
+
+	title := fmt.Sprintf("session %s, profile %s", ctrInfo.sessionID, ctrInfo.profile.Name)
+	if ctrInfo.researcher != "" {
+		title += ", researcher " + ctrInfo.researcher
+	}
+	rec := &recording{
+		log:   ctrInfo.logger(),
+		start: time.Now(),
+		f:     f,
+		max:   r.maxSize,
+	}
+	header, err := json.Marshal(castHeader{
+		Version:   2,
+		Width:     recordingWidth,
+		Height:    recordingHeight,
+		Timestamp: rec.start.Unix(),
+		Title:     title,
+		Env:       map[string]string{"TERM": "xterm", "SHELL": "/bin/sh"},
+
+		Session:    ctrInfo.sessionID,
+		Researcher: ctrInfo.researcher,
+	})
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := rec.write(header); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("writing recording header: %v", err)
+	}
+	return rec, nil
+}
+
+// output records output of the container.
+func (rec *recording) output(data []byte) {
+	rec.event("o", string(data))
+}
+
+// input records input from the browser.
+func (rec *recording) input(data string) {
+	rec.event("i", data)
+}
+
+// resize records a resize of the terminal.
+func (rec *recording) resize(height, width uint) {
+	rec.event("r", fmt.Sprintf("%dx%d", width, height))
+}
+
+// terminalEvent is the event type typ for the terminal id opened in the
+// container, like "o:1". Players skip event types they do not know, so they
+// play the terminal of the container only.
+func terminalEvent(typ, id string) string {
+	return typ + ":" + id
+}
+
+// terminalOpened records that the terminal id was opened in the container.
+func (rec *recording) terminalOpened(id string) {
+	rec.event(terminalEvent("t", id), "opened")
+}
+
+// terminalClosed records that the terminal id closed.
+func (rec *recording) terminalClosed(id string) {
+	rec.event(terminalEvent("t", id), "closed")
+}
+
+// terminalOutput records output of the terminal id.
+func (rec *recording) terminalOutput(id string, data []byte) {
+	rec.event(terminalEvent("o", id), string(data))
+}
+
+// terminalInput records input from the browser to the terminal id.
+func (rec *recording) terminalInput(id, data string) {
+	rec.event(terminalEvent("i", id), data)
+}
+
+// terminalResize records a resize of the terminal id.
+func (rec *recording) terminalResize(id string, height, width uint) {
+	rec.event(terminalEvent("r", id), fmt.Sprintf("%dx%d", width, height))
+}
+
+// event appends an event to the recording. Once the recording reaches its
+// size limit a marker is added and later events are dropped.
+func (rec *recording) event(typ, data string) {
+	if rec == nil {
+		return
+	}
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if rec.closed {
+		return
+	}
+
+	line, err := encodeCastEvent(time.Since(rec.start), typ, data)
+	if err != nil {
+		rec.log.Errorf("encoding recording event failed: %v", err)
+		return
+	}
+	if rec.max > 0 && rec.size+int64(len(line))+1 > rec.max {
+		rec.log.Warnf("recording reached its size limit of %s, stopping it", units.BytesSize(float64(rec.max)))
+		if line, err := encodeCastEvent(time.Since(rec.start), "m", "recording stopped: size limit reached"); err == nil {
+			rec.write(line)
+		}
+		rec.closeLocked()
+		return
+	}
+	if err := rec.write(line); err != nil {
+		rec.log.Errorf("writing recording failed, stopping it: %v", err)
+		rec.closeLocked()
+	}
+}
+
+// encodeCastEvent encodes an asciicast event at elapsed since the start.
+func encodeCastEvent(elapsed time.Duration, typ, data string) ([]byte, error) {
+	// microseconds are plenty for a terminal
+	t := math.Round(elapsed.Seconds()*1e6) / 1e6
+	return json.Marshal([]interface{}{t, typ, data})
+}
+
+func (rec *recording) write(line []byte) error {
+	n, err := rec.f.Write(append(line, '\n'))
+	rec.size += int64(n)
+	return err
+}
+
+// Close stops the recording.
+func (rec *recording) Close() error {
+	if rec == nil {
+		return nil
+	}
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	return rec.closeLocked()
+}
+
+func (rec *recording) closeLocked() error {
+	if rec.closed {
+		return nil
+	}
+	rec.closed = true
+	return rec.f.Close()
+}
+
+// pruneLoop removes the recordings past their retention right away and then
+// every recordingPruneInterval.
+func (r *recorder) pruneLoop() {
+	if r == nil || r.retention == 0 {
+		return
+	}
+	r.prune(time.Now())
+	ticker := time.NewTicker(recordingPruneInterval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		r.prune(now)
+	}
+}
+
+// prune removes the recordings last written to before now minus the
+// retention.
+func (r *recorder) prune(now time.Time) {
+	files, err := ioutil.ReadDir(r.dir)
+	if err != nil {
+		logrus.Errorf("listing recordings to prune failed: %v", err)
+		return
+	}
+	for _, fi := range files {
+		if fi.IsDir() || !strings.HasSuffix(fi.Name(), recordingExt) {
+			continue
+		}
+		if now.Sub(fi.ModTime()) < r.retention {
+			continue
+		}
+		if err := os.Remove(filepath.Join(r.dir, fi.Name())); err != nil {
+			logrus.Errorf("removing recording %s failed: %v", fi.Name(), err)
+			continue
+		}
+		logrus.Infof("removed recording %s past its retention of %s", fi.Name(), r.retention)
+	}
+}
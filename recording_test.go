@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readRecording parses the recording of a session.
+func readRecording(t *testing.T, dir, sessionID string) (castHeader, [][]interface{}) {
+	t.Helper()
+	f, err := os.Open(filepath.Join(dir, sessionID+recordingExt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	var header castHeader
+	if !s.Scan() {
+		t.Fatal("recording has no header")
+	}
+	if err := json.Unmarshal(s.Bytes(), &header); err != nil {
+		t.Fatalf("parsing recording header: %v", err)
+	}
+	var events [][]interface{}
+	for s.Scan() {
+		var event []interface{}
+		if err := json.Unmarshal(s.Bytes(), &event); err != nil {
+			t.Fatalf("parsing recording event %q: %v", s.Text(), err)
+		}
+		if len(event) != 3 {
+			t.Fatalf("expected events of 3 fields, got %q", s.Text())
+		}
+		events = append(events, event)
+	}
+	if err := s.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return header, events
+}
+
+func TestRecording(t *testing.T) {
+	dir := t.TempDir()
+	s := newTestServer(t, func(h *handler) {
+		h.recorder = &recorder{dir: dir}
+	})
+	conn := s.dial(t, "profile=default-docker")
+	ctr := waitForContainers(t, s.docker, 1)[0]
+	sessionID := ctr.config.Labels[sessionLabel]
+
+	send(t, conn, message{Type: "resize", Height: 30, Width: 100})
+	send(t, conn, message{Type: "stdin", Data: "id\n"})
+	readOutput(t, conn, "id\n")
+	closeSession(t, conn)
+	waitForContainers(t, s.docker, 0)
+
+	header, events := readRecording(t, dir, sessionID)
+	if header.Version != 2 || header.Width != recordingWidth || header.Height != recordingHeight {
+		t.Errorf("unexpected header %+v", header)
+	}
+	if !strings.Contains(header.Title, sessionID) {
+		t.Errorf("expected the title to name session %s, got %q", sessionID, header.Title)
+	}
+
+	var got []string
+	last := 0.0
+	for _, event := range events {
+		ts := event[0].(float64)
+		if ts < last {
+			t.Errorf("event times go back from %f to %f", last, ts)
+		}
+		last = ts
+		got = append(got, event[1].(string)+" "+event[2].(string))
+	}
+	if strings.Join(got, "|") != "r 100x30|i id\n|o id\n" {
+		t.Errorf("unexpected events %q", got)
+	}
+}
+
+func TestRecordingTerminals(t *testing.T) {
+	dir := t.TempDir()
+	s := newTestServer(t, func(h *handler) {
+		h.recorder = &recorder{dir: dir}
+	})
+	conn := s.dial(t, "profile=default-docker")
+	ctr := waitForContainers(t, s.docker, 1)[0]
+
+	id := openTerminal(t, conn)
+	send(t, conn, message{Type: "stdin", Data: "id\n", Terminal: id})
+	readTerminalOutput(t, conn, id, "id\n")
+	send(t, conn, message{Type: "close", Terminal: id})
+	readMessage(t, conn, "closed")
+	closeSession(t, conn)
+	waitForContainers(t, s.docker, 0)
+
+	// the events of the terminal are tagged with its ID
+	_, events := readRecording(t, dir, ctr.config.Labels[sessionLabel])
+	var got []string
+	for _, event := range events {
+		got = append(got, event[1].(string)+" "+event[2].(string))
+	}
+	want := []string{
+		"t:" + id + " opened",
+		"r:" + id + " 60x20",
+		"i:" + id + " id\n",
+		"o:" + id + " id\n",
+		"t:" + id + " closed",
+	}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("expected events %q, got %q", want, got)
+	}
+}
+
+func TestRecordingSizeLimit(t *testing.T) {
+	dir := t.TempDir()
+	s := newTestServer(t, func(h *handler) {
+		h.recorder = &recorder{dir: dir, maxSize: 1024}
+	})
+	conn := s.dial(t, "profile=default-docker")
+	ctr := waitForContainers(t, s.docker, 1)[0]
+
+	input := strings.Repeat("x", 100) + "\n"
+	for i := 0; i < 10; i++ {
+		send(t, conn, message{Type: "stdin", Data: input})
+		readOutput(t, conn, input)
+	}
+	closeSession(t, conn)
+	waitForContainers(t, s.docker, 0)
+
+	_, events := readRecording(t, dir, ctr.config.Labels[sessionLabel])
+	marker := events[len(events)-1]
+	if marker[1] != "m" {
+		t.Fatalf("expected the recording to end with a marker, got %q", marker)
+	}
+	fi, err := os.Stat(filepath.Join(dir, ctr.config.Labels[sessionLabel]+recordingExt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// only the marker can go over the limit
+	if fi.Size() > 1024+100 {
+		t.Errorf("expected the recording to stop at about 1024 bytes, got %d", fi.Size())
+	}
+}
+
+func TestRecordingPrune(t *testing.T) {
+	dir := t.TempDir()
+	r, err := newRecorder(dir, "0", 24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	for name, age := range map[string]time.Duration{
+		"old.cast":   25 * time.Hour,
+		"new.cast":   time.Hour,
+		"old.other":  25 * time.Hour,
+		"older.cast": 48 * time.Hour,
+	} {
+		file := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(file, nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(file, now.Add(-age), now.Add(-age)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r.prune(now)
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, fi := range files {
+		names = append(names, fi.Name())
+	}
+	if strings.Join(names, ",") != "new.cast,old.other" {
+		t.Errorf("expected new.cast and old.other to be kept, got %v", names)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/sirupsen/logrus"
+)
+
+// getProfiles returns the profiles new sessions are started with.
+func (h *handler) getProfiles() map[string]*profile {
+	h.profilesMu.RLock()
+	defer h.profilesMu.RUnlock()
+	return h.profiles
+}
+
+// reloadProfiles parses and validates the profiles directory again and swaps
+// in the new profiles the docker daemons can run. Running sessions keep the
+// profile they were started with. If any profile fails to load, the previous
+// profiles are kept.
+func (h *handler) reloadProfiles() error {
+	// Serialize reloads so the rendered index page always matches the
+	// profiles that are swapped in.
+	h.reloadMu.Lock()
+	defer h.reloadMu.Unlock()
+
+	profiles, err := loadProfiles(h.profilesDir)
+	if err != nil {
+		return err
+	}
+	profiles = h.supportedProfiles(profiles)
+	if len(profiles) == 0 {
+		return errors.New("the docker daemons cannot run any of the profiles")
+	}
+
+	if err := renderIndexPage(h.hostOS, profileNames(profiles), h.tokenSecret != nil); err != nil {
+		return err
+	}
+
+	h.profilesMu.Lock()
+	h.profiles = profiles
+	h.profilesMu.Unlock()
+
+	logrus.Infof("reloaded profiles: %s", strings.Join(profileNames(profiles), ", "))
+	return nil
+}
+
+// reloadOnSignal reloads the profiles every time the process receives a
+// SIGHUP.
+func (h *handler) reloadOnSignal() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGHUP)
+	for range c {
+		logrus.Info("received SIGHUP, reloading profiles")
+		if err := h.reloadProfiles(); err != nil {
+			logrus.Errorf("reloading profiles failed, keeping the previous profiles: %v", err)
+		}
+	}
+}
+
+// reloadHandler reloads the profiles and reports any validation error.
+func (h *handler) reloadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if err := h.reloadProfiles(); err != nil {
+		logrus.Errorf("reloading profiles failed, keeping the previous profiles: %v", err)
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		fmt.Fprintf(w, "reloading profiles failed, keeping the previous profiles: %v\n", err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "reloaded profiles: %s\n", strings.Join(profileNames(h.getProfiles()), ", "))
+}
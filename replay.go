@@ -0,0 +1,393 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/websocket"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// replayMaxSpeed is the fastest a recording can be replayed.
+	replayMaxSpeed = 64
+	// replayChunk is the most output sent to the browser in one message
+	// when seeking.
+	replayChunk = 32 * 1024
+	// terminalReset clears the terminal of the browser before seeking.
+	terminalReset = "\x1bc"
+)
+
+// sessionIDFormat is the format of the session IDs made by newID.
+var sessionIDFormat = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// replayEvent is an event of a recording.
+type replayEvent struct {
+	at   time.Duration
+	typ  string
+	data string
+}
+
+// load reads the recording of the session with id.
+func (r *recorder) load(id string) (castHeader, []replayEvent, error) {
+	var header castHeader
+	if !sessionIDFormat.MatchString(id) {
+		return header, nil, fmt.Errorf("invalid session ID %q", id)
+	}
+	f, err := os.Open(filepath.Join(r.dir, id+recordingExt))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return header, nil, fmt.Errorf("no recording of session %s", id)
+		}
+		return header, nil, err
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	s.Buffer(nil, 16*1024*1024)
+	if !s.Scan() {
+		return header, nil, fmt.Errorf("recording of session %s is empty", id)
+	}
+	if err := json.Unmarshal(s.Bytes(), &header); err != nil {
+		return header, nil, fmt.Errorf("parsing recording header: %v", err)
+	}
+	if header.Version != 2 {
+		return header, nil, fmt.Errorf("unsupported recording version %d", header.Version)
+	}
+
+	var events []replayEvent
+	for s.Scan() {
+		var (
+			at        float64
+			typ, data string
+		)
+		fields := []interface{}{&at, &typ, &data}
+		if err := json.Unmarshal(s.Bytes(), &fields); err != nil {
+			// the last line is cut off while the session is recorded
+			break
+		}
+		events = append(events, replayEvent{
+			at:   time.Duration(at * float64(time.Second)),
+			typ:  typ,
+			data: data,
+		})
+	}
+	return header, events, s.Err()
+}
+
+// replay plays a recording to a browser websocket.
+type replay struct {
+	conn   *lockedConn
+	log    *logrus.Entry
+	header castHeader
+	events []replayEvent
+
+	// pos is the time in the recording and next the index of the first
+	// event after it.
+	pos    time.Duration
+	next   int
+	paused bool
+	speed  float64
+	// terminals are the terminals opened in the container that are open
+	// at pos.
+	terminals map[string]bool
+}
+
+// replayHandler replays the recording of a session to a read-only websocket.
+// The browser controls the replay with "pause", "resume", "speed" and "seek"
+// messages, other messages are ignored.
+func (h *handler) replayHandler(w http.ResponseWriter, r *http.Request) {
+	wsConn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		logrus.Errorf("websocket upgrader failed: %v", err)
+		return
+	}
+	conn := &lockedConn{Conn: wsConn}
+
+	researcher, err := h.authenticate(r)
+	if err != nil {
+		logrus.Warnf("unauthenticated replay from %s: %v", r.RemoteAddr, err)
+		rejectSession(conn, websocket.ClosePolicyViolation, fmt.Sprintf("Authentication failed: %v.", err))
+		return
+	}
+	// without authentication anyone knowing a session ID could get in
+	if researcher == "" {
+		rejectSession(conn, websocket.ClosePolicyViolation, "Sessions can only be replayed with authentication enabled.")
+		return
+	}
+	log := logrus.WithFields(logrus.Fields{
+		"session":    r.URL.Query().Get("session"),
+		"researcher": researcher,
+	})
+	if h.recorder == nil {
+		rejectSession(conn, websocket.ClosePolicyViolation, "Sessions are not recorded.")
+		return
+	}
+
+	header, events, err := h.recorder.load(r.URL.Query().Get("session"))
+	if err != nil {
+		log.Warnf("loading recording failed: %v", err)
+		rejectSession(conn, websocket.ClosePolicyViolation, fmt.Sprintf("Loading recording failed: %v.", err))
+		return
+	}
+	if !h.mayReview(researcher, header.Researcher) {
+		log.Warnf("replay of a session of %q denied", header.Researcher)
+		rejectSession(conn, websocket.ClosePolicyViolation, "You may not replay this session.")
+		return
+	}
+	log.Info("replaying session")
+
+	p := &replay{
+		conn:   conn,
+		log:    log,
+		header: header,
+		events: events,
+		speed:  1,
+	}
+	if speed := r.URL.Query().Get("speed"); speed != "" {
+		if err := p.setSpeed(speed); err != nil {
+			p.notice(err.Error())
+		}
+	}
+	var start time.Duration
+	if t := r.URL.Query().Get("t"); t != "" {
+		start, err = p.seekTarget(t)
+		if err != nil {
+			p.notice(err.Error())
+		}
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	p.run(start, readBrowser(conn, stop, log))
+	conn.Close()
+}
+
+// run plays the recording from start until the browser goes away, acting on
+// its messages.
+func (p *replay) run(start time.Duration, msgs <-chan message) {
+	p.seek(start)
+	p.status()
+	for {
+		var (
+			timer   *time.Timer
+			wait    <-chan time.Time
+			started time.Time
+		)
+		if !p.paused && p.next < len(p.events) {
+			timer = time.NewTimer(time.Duration(float64(p.events[p.next].at-p.pos) / p.speed))
+			wait = timer.C
+			started = time.Now()
+		}
+
+		select {
+		case <-wait:
+			// send every event due at once
+			at := p.events[p.next].at
+			end := p.next
+			for end < len(p.events) && p.events[end].at <= at {
+				end++
+			}
+			p.emit(p.events[p.next:end])
+			p.pos, p.next = at, end
+			if p.next == len(p.events) {
+				p.status()
+			}
+		case data, ok := <-msgs:
+			if timer != nil {
+				timer.Stop()
+				// keep the time played until the message came
+				p.pos += time.Duration(float64(time.Since(started)) * p.speed)
+				if p.pos > p.events[p.next].at {
+					p.pos = p.events[p.next].at
+				}
+			}
+			if !ok {
+				return
+			}
+			p.control(data)
+		}
+	}
+}
+
+// control acts on a message from the browser.
+func (p *replay) control(data message) {
+	switch data.Type {
+	case "pause":
+		p.paused = true
+	case "resume":
+		p.paused = false
+	case "speed":
+		if err := p.setSpeed(data.Data); err != nil {
+			p.notice(err.Error())
+			return
+		}
+	case "seek":
+		to, err := p.seekTarget(data.Data)
+		if err != nil {
+			p.notice(err.Error())
+			return
+		}
+		p.seek(to)
+	case "stdin", "resize":
+		// the replay is read-only and has its own size
+		return
+	default:
+		p.log.Warnf("got unknown replay control: %s", data.Type)
+		return
+	}
+	p.status()
+}
+
+func (p *replay) setSpeed(speed string) error {
+	s, err := strconv.ParseFloat(speed, 64)
+	if err != nil || s <= 0 || s > replayMaxSpeed {
+		return fmt.Errorf("Speed must be a number above 0 and up to %d, given: %q.", replayMaxSpeed, speed)
+	}
+	p.speed = s
+	return nil
+}
+
+// seekTarget returns the time to seek to from t, which is a number of
+// seconds from the start or, starting with + or -, from the current time.
+func (p *replay) seekTarget(t string) (time.Duration, error) {
+	secs, err := strconv.ParseFloat(t, 64)
+	if err != nil {
+		return 0, fmt.Errorf("Seek to a number of seconds, given: %q.", t)
+	}
+	to := time.Duration(secs * float64(time.Second))
+	if strings.HasPrefix(t, "+") || strings.HasPrefix(t, "-") {
+		to += p.pos
+	}
+	return to, nil
+}
+
+// seek clears the terminal of the browser and redraws it as it was at to.
+func (p *replay) seek(to time.Duration) {
+	if to < 0 {
+		to = 0
+	}
+	if d := p.duration(); to > d {
+		to = d
+	}
+	next := 0
+	for next < len(p.events) && p.events[next].at <= to {
+		next++
+	}
+
+	for id := range p.terminals {
+		p.send(message{Type: "closed", Terminal: id})
+	}
+	p.terminals = map[string]bool{}
+	p.send(message{Type: "stdout", Data: terminalReset})
+	p.send(message{Type: "resize", Height: p.header.Height, Width: p.header.Width})
+	p.emit(p.events[:next])
+	p.pos, p.next = to, next
+}
+
+// emit sends events to the browser, joining their output.
+func (p *replay) emit(events []replayEvent) {
+	var (
+		out strings.Builder
+		// terminal is the terminal out is output of, empty for the
+		// terminal of the container
+		terminal string
+	)
+	flush := func() {
+		s := out.String()
+		for len(s) > 0 {
+			n := len(s)
+			if n > replayChunk {
+				n = replayChunk
+				// do not split a multi-byte character
+				for n > 0 && !utf8.RuneStart(s[n]) {
+					n--
+				}
+			}
+			p.send(message{Type: "stdout", Data: s[:n], Terminal: terminal})
+			s = s[n:]
+		}
+		out.Reset()
+	}
+	for _, e := range events {
+		// events of the terminals opened in the container carry their ID
+		typ, id := e.typ, ""
+		if i := strings.Index(e.typ, ":"); i >= 0 {
+			typ, id = e.typ[:i], e.typ[i+1:]
+		}
+		switch typ {
+		case "o":
+			if id != terminal {
+				flush()
+				terminal = id
+			}
+			out.WriteString(e.data)
+		case "r":
+			var width, height uint
+			if _, err := fmt.Sscanf(e.data, "%dx%d", &width, &height); err != nil {
+				p.log.Warnf("invalid resize %q in recording", e.data)
+				continue
+			}
+			flush()
+			p.send(message{Type: "resize", Height: height, Width: width, Terminal: id})
+		case "t":
+			flush()
+			switch e.data {
+			case "opened":
+				p.terminals[id] = true
+				p.send(message{Type: "terminal", Terminal: id})
+			case "closed":
+				delete(p.terminals, id)
+				p.send(message{Type: "closed", Data: fmt.Sprintf("Terminal %s closed.", id), Terminal: id})
+			}
+		case "m":
+			flush()
+			p.notice(e.data)
+		}
+	}
+	flush()
+}
+
+// duration returns the length of the recording.
+func (p *replay) duration() time.Duration {
+	if len(p.events) == 0 {
+		return 0
+	}
+	return p.events[len(p.events)-1].at
+}
+
+// status tells the browser where the replay is.
+func (p *replay) status() {
+	state := "playing"
+	switch {
+	case p.next == len(p.events):
+		state = "finished"
+	case p.paused:
+		state = "paused"
+	}
+	p.send(message{
+		Type: "replay",
+		Data: fmt.Sprintf("Replay of session %s: %s at %s of %s, speed %gx.",
+			p.header.Session, state, p.pos.Truncate(time.Second), p.duration().Truncate(time.Second), p.speed),
+	})
+}
+
+// notice tells the browser about a problem with one of its messages.
+func (p *replay) notice(text string) {
+	p.send(message{Type: "replay", Data: text})
+}
+
+func (p *replay) send(data message) {
+	if err := p.conn.WriteJSON(data); err != nil && err != websocket.ErrCloseSent {
+		p.log.Errorf("writing to replay websocket failed: %v", err)
+	}
+}
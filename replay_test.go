@@ -0,0 +1,287 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// testSessionID is the session of the recordings written by writeRecording.
+const testSessionID = "0123456789abcdef0123456789abcdef"
+
+// writeRecording writes a two seconds long recording of a session of
+// researcher to dir.
+func writeRecording(t *testing.T, dir, researcher string) {
+	t.Helper()
+	writeRecordingEvents(t, dir, researcher,
+		`[0.1, "o", "$ "]`,
+		`[0.2, "i", "ls\n"]`,
+		`[0.3, "o", "ls\n"]`,
+		`[0.5, "r", "100x30"]`,
+		`[1.0, "o", "bin etc\n"]`,
+		`[2.0, "o", "$ "]`,
+	)
+}
+
+// writeRecordingEvents writes a recording of a session of researcher with
+// events to dir.
+func writeRecordingEvents(t *testing.T, dir, researcher string, events ...string) {
+	t.Helper()
+	header, err := json.Marshal(castHeader{
+		Version:    2,
+		Width:      80,
+		Height:     24,
+		Session:    testSessionID,
+		Researcher: researcher,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := append([]string{string(header)}, events...)
+	if err := ioutil.WriteFile(filepath.Join(dir, testSessionID+recordingExt), []byte(strings.Join(lines, "\n")+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// dialReplay opens a replay with the query parameters in query.
+func (s *testServer) dialReplay(t *testing.T, query string) *websocket.Conn {
+	t.Helper()
+	u := "ws" + strings.TrimPrefix(s.URL, "http") + "/replay?" + query
+	conn, _, err := websocket.DefaultDialer.Dial(u, nil)
+	if err != nil {
+		t.Fatalf("dialing %s: %v", u, err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// readReplay reads the messages of a replay up to and including the next
+// status, and returns them in a short form.
+func readReplay(t *testing.T, conn *websocket.Conn) []string {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(testTimeout))
+	var got []string
+	for {
+		var msg message
+		if err := conn.ReadJSON(&msg); err != nil {
+			t.Fatalf("reading replay: %v, got so far: %q", err, got)
+		}
+		typ := msg.Type
+		if msg.Terminal != "" {
+			typ += ":" + msg.Terminal
+		}
+		switch msg.Type {
+		case "resize":
+			got = append(got, fmt.Sprintf("%s %dx%d", typ, msg.Width, msg.Height))
+		case "replay":
+			return append(got, msg.Data)
+		default:
+			got = append(got, typ+" "+msg.Data)
+		}
+	}
+}
+
+func expectReplay(t *testing.T, conn *websocket.Conn, want ...string) {
+	t.Helper()
+	got := readReplay(t, conn)
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("expected replay:\n%q\ngot:\n%q", want, got)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	dir := t.TempDir()
+	writeRecording(t, dir, "alice")
+	s := newTestServer(t, func(h *handler) {
+		h.recorder = &recorder{dir: dir}
+		h.tokenSecret = testSecret
+	})
+	conn := s.dialReplay(t, "session="+testSessionID+"&speed=64&token="+testToken(t, "alice"))
+
+	expectReplay(t, conn,
+		"stdout "+terminalReset,
+		"resize 80x24",
+		"Replay of session "+testSessionID+": playing at 0s of 2s, speed 64x.",
+	)
+	// input is not replayed, the terminal echoes it
+	expectReplay(t, conn,
+		"stdout $ ",
+		"stdout ls\n",
+		"resize 100x30",
+		"stdout bin etc\n",
+		"stdout $ ",
+		"Replay of session "+testSessionID+": finished at 2s of 2s, speed 64x.",
+	)
+}
+
+func TestReplayControls(t *testing.T) {
+	dir := t.TempDir()
+	writeRecording(t, dir, "alice")
+	s := newTestServer(t, func(h *handler) {
+		h.recorder = &recorder{dir: dir}
+		h.tokenSecret = testSecret
+	})
+	conn := s.dialReplay(t, "session="+testSessionID+"&t=0.6&token="+testToken(t, "alice"))
+
+	// the output up to the start is sent at once
+	expectReplay(t, conn,
+		"stdout "+terminalReset,
+		"resize 80x24",
+		"stdout $ ls\n",
+		"resize 100x30",
+		"Replay of session "+testSessionID+": playing at 0s of 2s, speed 1x.",
+	)
+
+	send(t, conn, message{Type: "pause"})
+	got := readReplay(t, conn)
+	if len(got) != 1 || !strings.Contains(got[0], ": paused at 0s of 2s") {
+		t.Errorf("expected the replay to pause, got %q", got)
+	}
+
+	// input and resizes are ignored
+	send(t, conn, message{Type: "stdin", Data: "rm -rf /\n"})
+	send(t, conn, message{Type: "resize", Height: 10, Width: 10})
+
+	send(t, conn, message{Type: "seek", Data: "+10"})
+	expectReplay(t, conn,
+		"stdout "+terminalReset,
+		"resize 80x24",
+		"stdout $ ls\n",
+		"resize 100x30",
+		"stdout bin etc\n$ ",
+		"Replay of session "+testSessionID+": finished at 2s of 2s, speed 1x.",
+	)
+
+	send(t, conn, message{Type: "speed", Data: "0"})
+	got = readReplay(t, conn)
+	if len(got) != 1 || !strings.Contains(got[0], "Speed must be a number") {
+		t.Errorf("expected an invalid speed notice, got %q", got)
+	}
+
+	send(t, conn, message{Type: "seek", Data: "0"})
+	expectReplay(t, conn,
+		"stdout "+terminalReset,
+		"resize 80x24",
+		"Replay of session "+testSessionID+": paused at 0s of 2s, speed 1x.",
+	)
+	send(t, conn, message{Type: "speed", Data: "64"})
+	expectReplay(t, conn, "Replay of session "+testSessionID+": paused at 0s of 2s, speed 64x.")
+
+	send(t, conn, message{Type: "resume"})
+	expectReplay(t, conn, "Replay of session "+testSessionID+": playing at 0s of 2s, speed 64x.")
+	expectReplay(t, conn,
+		"stdout $ ",
+		"stdout ls\n",
+		"resize 100x30",
+		"stdout bin etc\n",
+		"stdout $ ",
+		"Replay of session "+testSessionID+": finished at 2s of 2s, speed 64x.",
+	)
+}
+
+func TestReplayTerminals(t *testing.T) {
+	dir := t.TempDir()
+	writeRecordingEvents(t, dir, "alice",
+		`[0.1, "o", "$ "]`,
+		`[0.2, "t:1", "opened"]`,
+		`[0.3, "r:1", "60x20"]`,
+		`[0.4, "o:1", "# "]`,
+		`[0.5, "i:1", "id\n"]`,
+		`[0.6, "o:1", "id\n"]`,
+		`[0.7, "t:1", "closed"]`,
+		`[1.0, "o", "$ "]`,
+	)
+	s := newTestServer(t, func(h *handler) {
+		h.recorder = &recorder{dir: dir}
+		h.tokenSecret = testSecret
+	})
+	conn := s.dialReplay(t, "session="+testSessionID+"&t=0.65&speed=0.01&token="+testToken(t, "alice"))
+
+	// the terminal is open at the start
+	expectReplay(t, conn,
+		"stdout "+terminalReset,
+		"resize 80x24",
+		"stdout $ ",
+		"terminal:1 ",
+		"resize:1 60x20",
+		"stdout:1 # id\n",
+		"Replay of session "+testSessionID+": playing at 0s of 1s, speed 0.01x.",
+	)
+	send(t, conn, message{Type: "pause"})
+	readReplay(t, conn)
+
+	// seeking closes it before redrawing
+	send(t, conn, message{Type: "seek", Data: "0"})
+	expectReplay(t, conn,
+		"closed:1 ",
+		"stdout "+terminalReset,
+		"resize 80x24",
+		"Replay of session "+testSessionID+": paused at 0s of 1s, speed 0.01x.",
+	)
+	send(t, conn, message{Type: "seek", Data: "1"})
+	expectReplay(t, conn,
+		"stdout "+terminalReset,
+		"resize 80x24",
+		"stdout $ ",
+		"terminal:1 ",
+		"resize:1 60x20",
+		"stdout:1 # id\n",
+		"closed:1 Terminal 1 closed.",
+		"stdout $ ",
+		"Replay of session "+testSessionID+": finished at 1s of 1s, speed 0.01x.",
+	)
+}
+
+func TestReplayAuth(t *testing.T) {
+	dir := t.TempDir()
+	writeRecording(t, dir, "alice")
+	s := newTestServer(t, func(h *handler) {
+		h.recorder = &recorder{dir: dir}
+		h.tokenSecret = testSecret
+		h.reviewers = map[string]bool{"carol": true}
+	})
+
+	for _, tc := range []struct {
+		query, rejection string
+	}{
+		{"session=" + testSessionID, "missing access token"},
+		{"session=" + testSessionID + "&token=" + testToken(t, "bob"), "You may not replay this session."},
+		{"session=../../etc/passwd&token=" + testToken(t, "carol"), "invalid session ID"},
+		{"session=" + strings.Repeat("f", 32) + "&token=" + testToken(t, "carol"), "no recording of session"},
+	} {
+		conn := s.dialReplay(t, tc.query)
+		msg := readMessage(t, conn, "rejected")
+		if !strings.Contains(msg.Data, tc.rejection) {
+			t.Errorf("%s: expected rejection %q, got %q", tc.query, tc.rejection, msg.Data)
+		}
+		expectClose(t, conn, websocket.ClosePolicyViolation)
+	}
+
+	for _, researcher := range []string{"alice", "carol"} {
+		conn := s.dialReplay(t, "session="+testSessionID+"&token="+testToken(t, researcher))
+		got := readReplay(t, conn)
+		if !strings.Contains(got[len(got)-1], "Replay of session "+testSessionID) {
+			t.Errorf("expected %s to replay the session, got %q", researcher, got)
+		}
+	}
+}
+
+func TestReplayWithoutAuth(t *testing.T) {
+	dir := t.TempDir()
+	writeRecording(t, dir, "")
+	s := newTestServer(t, func(h *handler) {
+		h.recorder = &recorder{dir: dir}
+	})
+
+	conn := s.dialReplay(t, "session="+testSessionID)
+	if msg := readMessage(t, conn, "rejected"); !strings.Contains(msg.Data, "authentication enabled") {
+		t.Errorf("expected replaying without authentication to be rejected, got %q", msg.Data)
+	}
+	expectClose(t, conn, websocket.ClosePolicyViolation)
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/go-units"
+)
+
+// Resource limits applied when a profile does not set them.
+const (
+	defaultMemory    = "512m"
+	defaultCPUPeriod = 100000
+	defaultCPUQuota  = 100000
+	defaultCPUShares = 1024
+	defaultPidsLimit = 5
+)
+
+// defaultUlimits are applied when a profile does not set any ulimits.
+var defaultUlimits = []string{"nofile=1024:1024"}
+
+// profileResources holds the resource limits of a profile.
+type profileResources struct {
+	// Memory is the memory limit, like "512m", defaults to defaultMemory.
+	Memory string `json:"memory,omitempty"`
+	// MemorySwap is the limit of memory plus swap, like "1g" or "-1" for
+	// unlimited swap, defaults to Memory which disables swap.
+	MemorySwap string `json:"memorySwap,omitempty"`
+	// CPUQuota is the CPU time in microseconds the container can use every
+	// CPUPeriod, they default to defaultCPUQuota and defaultCPUPeriod.
+	CPUQuota  int64 `json:"cpuQuota,omitempty"`
+	CPUPeriod int64 `json:"cpuPeriod,omitempty"`
+	// CPUShares is the relative CPU weight of the container, defaults to
+	// defaultCPUShares.
+	CPUShares int64 `json:"cpuShares,omitempty"`
+	// PidsLimit is the maximum number of processes, -1 for no limit. 0
+	// means the default, defaultPidsLimit.
+	PidsLimit int64 `json:"pidsLimit,omitempty"`
+	// Ulimits are written like "nofile=1024:2048", defaults to
+	// defaultUlimits.
+	Ulimits []string `json:"ulimits,omitempty"`
+	// DiskSize limits the size of the writable layer of the container, like
+	// "10g". It requires a storage driver that supports the size storage
+	// option, there is no limit when unset.
+	DiskSize string `json:"diskSize,omitempty"`
+
+	memory     int64
+	memorySwap int64
+	ulimits    []*units.Ulimit
+}
+
+// parse validates the resource limits and fills in the defaults.
+func (r *profileResources) parse() error {
+	if r.Memory == "" {
+		r.Memory = defaultMemory
+	}
+	memory, err := units.RAMInBytes(r.Memory)
+	if err != nil {
+		return fmt.Errorf("invalid memory %q: %v", r.Memory, err)
+	}
+	if memory <= 0 {
+		return fmt.Errorf("memory must be positive, given: %q", r.Memory)
+	}
+	r.memory = memory
+
+	switch r.MemorySwap {
+	case "":
+		r.memorySwap = r.memory
+	case "-1":
+		r.memorySwap = -1
+	default:
+		swap, err := units.RAMInBytes(r.MemorySwap)
+		if err != nil {
+			return fmt.Errorf("invalid memorySwap %q: %v", r.MemorySwap, err)
+		}
+		if swap < r.memory {
+			return fmt.Errorf("memorySwap %q must be at least memory %q", r.MemorySwap, r.Memory)
+		}
+		r.memorySwap = swap
+	}
+
+	if r.CPUPeriod == 0 {
+		r.CPUPeriod = defaultCPUPeriod
+	}
+	if r.CPUQuota == 0 {
+		r.CPUQuota = defaultCPUQuota
+	}
+	if r.CPUShares == 0 {
+		r.CPUShares = defaultCPUShares
+	}
+	if r.PidsLimit == 0 {
+		r.PidsLimit = defaultPidsLimit
+	}
+	// these are the bounds enforced by the kernel and the docker daemon
+	if r.CPUPeriod < 1000 || r.CPUPeriod > 1000000 {
+		return fmt.Errorf("cpuPeriod must be between 1000 and 1000000, given: %d", r.CPUPeriod)
+	}
+	if r.CPUQuota < 1000 {
+		return fmt.Errorf("cpuQuota must be at least 1000, given: %d", r.CPUQuota)
+	}
+	if r.CPUShares < 2 {
+		return fmt.Errorf("cpuShares must be at least 2, given: %d", r.CPUShares)
+	}
+	if r.PidsLimit < -1 {
+		return fmt.Errorf("pids limit must be positive or -1 for no limit, given: %d", r.PidsLimit)
+	}
+
+	if len(r.Ulimits) == 0 {
+		r.Ulimits = defaultUlimits
+	}
+	r.ulimits = nil
+	for _, u := range r.Ulimits {
+		ulimit, err := units.ParseUlimit(u)
+		if err != nil {
+			return fmt.Errorf("invalid ulimit %q: %v", u, err)
+		}
+		r.ulimits = append(r.ulimits, ulimit)
+	}
+
+	if r.DiskSize != "" {
+		if _, err := units.RAMInBytes(r.DiskSize); err != nil {
+			return fmt.Errorf("invalid diskSize %q: %v", r.DiskSize, err)
+		}
+	}
+
+	return nil
+}
+
+// apply sets the resource limits on the host config of a container.
+func (r *profileResources) apply(cfg *container.HostConfig) {
+	cfg.Resources.Memory = r.memory
+	cfg.Resources.MemorySwap = r.memorySwap
+	cfg.Resources.CPUPeriod = r.CPUPeriod
+	cfg.Resources.CPUQuota = r.CPUQuota
+	cfg.Resources.CPUShares = r.CPUShares
+	cfg.Resources.PidsLimit = r.PidsLimit
+	cfg.Resources.Ulimits = r.ulimits
+
+	if r.DiskSize != "" {
+		if cfg.StorageOpt == nil {
+			cfg.StorageOpt = map[string]string{}
+		}
+		cfg.StorageOpt["size"] = r.DiskSize
+	}
+}
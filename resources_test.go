@@ -0,0 +1,44 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPidsLimit(t *testing.T) {
+	for _, tc := range []struct {
+		given, want int64
+		valid       bool
+	}{
+		{0, defaultPidsLimit, true},
+		{100, 100, true},
+		{-1, -1, true},
+		{-2, 0, false},
+	} {
+		r := profileResources{PidsLimit: tc.given}
+		err := r.parse()
+		if (err == nil) != tc.valid {
+			t.Errorf("pidsLimit %d: expected valid %t, got error %v", tc.given, tc.valid, err)
+			continue
+		}
+		if tc.valid && r.PidsLimit != tc.want {
+			t.Errorf("pidsLimit %d: expected %d, got %d", tc.given, tc.want, r.PidsLimit)
+		}
+	}
+}
+
+func TestUlimits(t *testing.T) {
+	r := profileResources{Ulimits: []string{"nofile=1024:2048"}}
+	if err := r.parse(); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.ulimits) != 1 || r.ulimits[0].Name != "nofile" || r.ulimits[0].Soft != 1024 || r.ulimits[0].Hard != 2048 {
+		t.Errorf("expected nofile=1024:2048, got %v", r.ulimits)
+	}
+
+	r = profileResources{Ulimits: []string{"nofile=lots"}}
+	err := r.parse()
+	if err == nil || !strings.HasPrefix(err.Error(), `invalid ulimit "nofile=lots": `) {
+		t.Errorf("expected the invalid ulimit to be named in the error, got %v", err)
+	}
+}
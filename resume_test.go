@@ -0,0 +1,164 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// startResumable opens a session that can be resumed and returns its
+// websocket and resume token.
+func startResumable(t *testing.T, s *testServer, query string) (*websocket.Conn, string) {
+	t.Helper()
+	conn := s.dial(t, query)
+	token := readMessage(t, conn, "session").Data
+	if token == "" {
+		t.Fatal("expected a resume token")
+	}
+	return conn, token
+}
+
+func TestResume(t *testing.T) {
+	s := newTestServer(t, func(h *handler) {
+		h.resumeGrace = time.Minute
+	})
+	conn, token := startResumable(t, s, "profile=default-docker")
+	ctr := waitForContainers(t, s.docker, 1)[0]
+
+	send(t, conn, message{Type: "stdin", Data: "echo one\n"})
+	readOutput(t, conn, "echo one\n")
+
+	// the browser goes away without closing the websocket
+	conn.Close()
+	waitFor(t, "browser to leave", func() bool {
+		ctrInfo := s.h.session(ctr.config.Labels[sessionLabel])
+		ctrInfo.browserMu.Lock()
+		defer ctrInfo.browserMu.Unlock()
+		return ctrInfo.browser == nil
+	})
+
+	resumed := s.dial(t, "resume="+token)
+	if out := readOutput(t, resumed, "echo one\n"); !strings.HasPrefix(out, terminalReset) {
+		t.Errorf("expected the scrollback after a terminal reset, got %q", out)
+	}
+	send(t, resumed, message{Type: "stdin", Data: "echo two\n"})
+	readOutput(t, resumed, "echo two\n")
+	if ctrs := s.docker.snapshot(); len(ctrs) != 1 || ctrs[0].id != ctr.id {
+		t.Errorf("expected container %s to be kept, got %d containers", ctr.id, len(ctrs))
+	}
+
+	// the session still ends with its container
+	if err := s.docker.exit(ctr.id, 0); err != nil {
+		t.Fatal(err)
+	}
+	expectClose(t, resumed, websocket.CloseNormalClosure)
+	waitForContainers(t, s.docker, 0)
+
+	conn = s.dial(t, "resume="+token)
+	if msg := readMessage(t, conn, "rejected"); !strings.Contains(msg.Data, "cannot be resumed") {
+		t.Errorf("expected resuming an ended session to be rejected, got %q", msg.Data)
+	}
+	expectClose(t, conn, websocket.ClosePolicyViolation)
+}
+
+func TestResumeGraceExpired(t *testing.T) {
+	s := newTestServer(t, func(h *handler) {
+		h.resumeGrace = 50 * time.Millisecond
+	})
+	conn, _ := startResumable(t, s, "profile=default-docker")
+	waitForContainers(t, s.docker, 1)
+
+	closeSession(t, conn)
+	waitForContainers(t, s.docker, 0)
+	waitFor(t, "session to end", func() bool { return len(s.h.liveSessions()) == 0 })
+}
+
+func TestResumeTakeover(t *testing.T) {
+	s := newTestServer(t, func(h *handler) {
+		h.resumeGrace = time.Minute
+	})
+	conn, token := startResumable(t, s, "profile=default-docker")
+	waitForContainers(t, s.docker, 1)
+
+	// a second tab takes the session over
+	resumed := s.dial(t, "resume="+token)
+	expectClose(t, conn, websocket.ClosePolicyViolation)
+	send(t, resumed, message{Type: "stdin", Data: "echo taken\n"})
+	readOutput(t, resumed, "echo taken\n")
+	if ctrs := s.docker.snapshot(); len(ctrs) != 1 {
+		t.Errorf("expected the container to be kept, got %d containers", len(ctrs))
+	}
+}
+
+func TestResumeAuth(t *testing.T) {
+	s := newTestServer(t, func(h *handler) {
+		h.tokenSecret = testSecret
+		h.resumeGrace = time.Minute
+	})
+	_, resumeToken := startResumable(t, s, "profile=default-docker&token="+testToken(t, "alice"))
+	waitForContainers(t, s.docker, 1)
+
+	for _, query := range []string{
+		"resume=" + resumeToken + "&token=" + testToken(t, "bob"),
+		"resume=" + strings.Repeat("f", 32) + "&token=" + testToken(t, "alice"),
+	} {
+		conn := s.dial(t, query)
+		if msg := readMessage(t, conn, "rejected"); !strings.Contains(msg.Data, "cannot be resumed") {
+			t.Errorf("%s: expected the session not to be resumed, got %q", query, msg.Data)
+		}
+		expectClose(t, conn, websocket.ClosePolicyViolation)
+	}
+}
+
+func TestResumeDisabled(t *testing.T) {
+	s := newTestServer(t, nil)
+	conn := s.dial(t, "profile=default-docker")
+	waitForContainers(t, s.docker, 1)
+
+	// without a grace period the browser gets no token
+	send(t, conn, message{Type: "stdin", Data: "echo hello\n"})
+	conn.SetReadDeadline(time.Now().Add(testTimeout))
+	var out string
+	for !strings.Contains(out, "echo hello\n") {
+		var msg message
+		if err := conn.ReadJSON(&msg); err != nil {
+			t.Fatal(err)
+		}
+		if msg.Type == "session" {
+			t.Fatal("expected no resume token without a grace period")
+		}
+		out += msg.Data
+	}
+
+	conn.Close()
+	waitForContainers(t, s.docker, 0)
+}
+
+func TestRingBuffer(t *testing.T) {
+	r := newRingBuffer(8)
+	r.write([]byte("abc"))
+	r.write([]byte("defgh"))
+	if got := r.String(); got != "abcdefgh" {
+		t.Errorf("expected abcdefgh, got %q", got)
+	}
+	r.write([]byte("ij"))
+	if got := r.String(); got != "cdefghij" {
+		t.Errorf("expected cdefghij, got %q", got)
+	}
+	r.write([]byte("0123456789"))
+	if got := r.String(); got != "23456789" {
+		t.Errorf("expected 23456789, got %q", got)
+	}
+	// a character cut by the size is dropped whole
+	r.write([]byte("✓✓"))
+	r.write([]byte("k"))
+	if got := r.String(); got != "9✓✓k" {
+		t.Errorf("expected 9✓✓k, got %q", got)
+	}
+	r.write([]byte("lm"))
+	if got := r.String(); got != "✓klm" {
+		t.Errorf("expected ✓klm, got %q", got)
+	}
+}
@@ -0,0 +1,390 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/sirupsen/logrus"
+)
+
+const seccompHelp = `Inspect seccomp profiles.
+
+diff <a> <b>	Print the syscalls that become allowed or denied going from
+		profile a to profile b, per architecture and capability set.
+
+Profiles are docker profile names from the profiles directory, names of
+builtin seccomp profiles or paths to seccomp JSON files. Docker profiles are
+resolved with their own capabilities unless -caps is given.
+
+The seccomp command has to be the first argument, global flags like -profiles
+follow it:
+
+	contained.af seccomp -profiles /etc/contained.af/profiles diff a b`
+
+// defaultCapabilities are the capabilities docker grants containers by
+// default.
+var defaultCapabilities = []string{
+	"CAP_AUDIT_WRITE",
+	"CAP_CHOWN",
+	"CAP_DAC_OVERRIDE",
+	"CAP_FOWNER",
+	"CAP_FSETID",
+	"CAP_KILL",
+	"CAP_MKNOD",
+	"CAP_NET_BIND_SERVICE",
+	"CAP_NET_RAW",
+	"CAP_SETFCAP",
+	"CAP_SETGID",
+	"CAP_SETPCAP",
+	"CAP_SETUID",
+	"CAP_SYS_CHROOT",
+}
+
+type seccompCommand struct{}
+
+func (cmd *seccompCommand) Name() string { return "seccomp" }
+func (cmd *seccompCommand) Args() string { return "diff [OPTIONS] <a> <b>" }
+func (cmd *seccompCommand) ShortHelp() string {
+	return "Explain the difference between two seccomp profiles"
+}
+func (cmd *seccompCommand) LongHelp() string { return seccompHelp }
+func (cmd *seccompCommand) Hidden() bool     { return false }
+
+func (cmd *seccompCommand) Register(fs *flag.FlagSet) {}
+
+func (cmd *seccompCommand) Run(ctx context.Context, args []string) error {
+	if len(args) < 1 || args[0] != "diff" {
+		return errors.New("must pass a subcommand: diff")
+	}
+
+	fs := flag.NewFlagSet("seccomp diff", flag.ExitOnError)
+	arches := fs.String("arch", "", "comma separated architectures to compare (default: the architectures of the profiles)")
+	caps := fs.String("caps", "", "comma separated capabilities of the container (default: the capabilities of the profiles)")
+	asJSON := fs.Bool("json", false, "print the differences as JSON")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		return errors.New("must pass two profiles to compare")
+	}
+
+	a, err := loadSeccompTarget(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	b, err := loadSeccompTarget(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	if *caps != "" {
+		a.caps = normalizeCapabilities(strings.Split(*caps, ","))
+		b.caps = a.caps
+	}
+
+	var archList []string
+	if *arches != "" {
+		for _, arch := range strings.Split(*arches, ",") {
+			if _, ok := ruleArches[arch]; !ok {
+				return fmt.Errorf("unknown architecture %q", arch)
+			}
+			archList = append(archList, arch)
+		}
+	} else {
+		archList = profileArches(a.seccomp, b.seccomp)
+	}
+
+	changes := diffSeccomp(a, b, archList)
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(changes)
+	}
+	printSeccompChanges(os.Stdout, changes)
+	return nil
+}
+
+// seccompTarget is a seccomp profile together with the capabilities of the
+// container it applies to.
+type seccompTarget struct {
+	seccomp *seccompProfile
+	caps    map[string]struct{}
+}
+
+// loadSeccompTarget loads a docker profile from the profiles directory, a
+// builtin seccomp profile or a seccomp file. Docker profiles take precedence
+// over builtin seccomp profiles with the same name.
+func loadSeccompTarget(ref string) (*seccompTarget, error) {
+	file := filepath.Join(profilesDir, ref+profileExt)
+	_, builtin := seccompConfigs[ref]
+	isProfile := false
+	if filepath.Ext(ref) == "" {
+		if _, err := os.Stat(file); err == nil {
+			isProfile = true
+		}
+	}
+	if isProfile && builtin {
+		logrus.Warnf("%q is both a docker profile and a builtin seccomp profile, using the docker profile %s", ref, file)
+	}
+	if isProfile || (!builtin && filepath.Ext(ref) == "") {
+		p, err := loadProfile(file)
+		if err != nil {
+			return nil, err
+		}
+		return &seccompTarget{seccomp: p.seccomp, caps: p.capabilities()}, nil
+	}
+
+	s, err := loadSeccomp(ref, ".")
+	if err != nil {
+		return nil, err
+	}
+	return &seccompTarget{seccomp: s, caps: normalizeCapabilities(defaultCapabilities)}, nil
+}
+
+// capabilities returns the capabilities of the containers started with the
+// profile.
+func (p *profile) capabilities() map[string]struct{} {
+	caps := map[string]struct{}{}
+	for _, c := range defaultCapabilities {
+		caps[c] = struct{}{}
+	}
+	for c := range normalizeCapabilities(p.CapDrop) {
+		if c == "CAP_ALL" {
+			caps = map[string]struct{}{}
+			break
+		}
+		delete(caps, c)
+	}
+	for c := range normalizeCapabilities(p.CapAdd) {
+		if c == "CAP_ALL" {
+			for all := range capabilities {
+				if all != "ALL" {
+					caps["CAP_"+all] = struct{}{}
+				}
+			}
+			continue
+		}
+		caps[c] = struct{}{}
+	}
+	return caps
+}
+
+// normalizeCapabilities returns caps in the "CAP_<NAME>" form used by
+// seccomp profiles.
+func normalizeCapabilities(caps []string) map[string]struct{} {
+	m := map[string]struct{}{}
+	for _, c := range caps {
+		c = strings.ToUpper(strings.TrimSpace(c))
+		if c == "" {
+			continue
+		}
+		if !strings.HasPrefix(c, "CAP_") {
+			c = "CAP_" + c
+		}
+		m[c] = struct{}{}
+	}
+	return m
+}
+
+// profileArches returns the architectures and subarchitectures of the
+// archMaps of profiles, as used by includes and excludes.
+func profileArches(profiles ...*seccompProfile) []string {
+	seen := map[string]struct{}{}
+	for _, s := range profiles {
+		for _, a := range s.ArchMap {
+			for _, arch := range append([]string{a.Architecture}, a.SubArchitectures...) {
+				seen[seccompArches[arch]] = struct{}{}
+			}
+		}
+	}
+	if len(seen) == 0 {
+		for table := range syscallTables {
+			seen[table] = struct{}{}
+		}
+	}
+	return sortedKeys(seen)
+}
+
+// seccompVerdict is what a rule decides for a syscall.
+type seccompVerdict struct {
+	Action string       `json:"action"`
+	Args   []seccompArg `json:"args,omitempty"`
+}
+
+func (v seccompVerdict) String() string {
+	if len(v.Args) == 0 {
+		return v.Action
+	}
+	var conds []string
+	for _, arg := range v.Args {
+		op := strings.TrimPrefix(arg.Op, "SCMP_CMP_")
+		if arg.Op == "SCMP_CMP_MASKED_EQ" {
+			conds = append(conds, fmt.Sprintf("arg%d&%#x == %#x", arg.Index, arg.Value, arg.ValueTwo))
+			continue
+		}
+		conds = append(conds, fmt.Sprintf("arg%d %s %#x", arg.Index, op, arg.Value))
+	}
+	return fmt.Sprintf("%s if %s", v.Action, strings.Join(conds, " && "))
+}
+
+// seccompChange is a syscall whose verdicts differ between two profiles.
+type seccompChange struct {
+	Arch    string           `json:"arch"`
+	Syscall string           `json:"syscall"`
+	Change  string           `json:"change"`
+	From    []seccompVerdict `json:"from"`
+	To      []seccompVerdict `json:"to"`
+}
+
+// effective returns the verdicts of every syscall the profile has a rule
+// for, on arch for a container with caps, the same way the docker daemon
+// selects the rules of a profile.
+func (s *seccompProfile) effective(arch string, caps map[string]struct{}) map[string][]seccompVerdict {
+	hasArch := func(arches []string) bool {
+		for _, a := range arches {
+			if ruleArches[a] == arch {
+				return true
+			}
+		}
+		return false
+	}
+
+	verdicts := map[string][]seccompVerdict{}
+Rules:
+	for _, rule := range s.Syscalls {
+		if len(rule.Includes.Arches) > 0 && !hasArch(rule.Includes.Arches) {
+			continue
+		}
+		if len(rule.Excludes.Arches) > 0 && hasArch(rule.Excludes.Arches) {
+			continue
+		}
+		for _, c := range rule.Includes.Caps {
+			if _, ok := caps[c]; !ok {
+				continue Rules
+			}
+		}
+		for _, c := range rule.Excludes.Caps {
+			if _, ok := caps[c]; ok {
+				continue Rules
+			}
+		}
+
+		for _, name := range rule.syscalls() {
+			if _, ok := syscallTables[arch][name]; !ok {
+				continue
+			}
+			v := seccompVerdict{Action: rule.Action, Args: rule.Args}
+			if !hasVerdict(verdicts[name], v) {
+				verdicts[name] = append(verdicts[name], v)
+			}
+		}
+	}
+	return verdicts
+}
+
+func hasVerdict(verdicts []seccompVerdict, v seccompVerdict) bool {
+	for _, have := range verdicts {
+		if have.String() == v.String() {
+			return true
+		}
+	}
+	return false
+}
+
+// allowLevel returns 0 if verdicts never allow a syscall, 1 if they allow it
+// depending on its arguments and 2 if they always allow it.
+func allowLevel(verdicts []seccompVerdict) int {
+	level := 0
+	for _, v := range verdicts {
+		if v.Action != "SCMP_ACT_ALLOW" {
+			continue
+		}
+		if len(v.Args) == 0 {
+			return 2
+		}
+		level = 1
+	}
+	return level
+}
+
+// diffSeccomp compares the effective verdicts of a and b on every arch.
+func diffSeccomp(a, b *seccompTarget, arches []string) []seccompChange {
+	changes := []seccompChange{}
+	for _, arch := range arches {
+		from := a.seccomp.effective(ruleArches[arch], a.caps)
+		to := b.seccomp.effective(ruleArches[arch], b.caps)
+
+		for name := range syscallTables[ruleArches[arch]] {
+			f, ok := from[name]
+			if !ok {
+				f = []seccompVerdict{{Action: a.seccomp.DefaultAction}}
+			}
+			t, ok := to[name]
+			if !ok {
+				t = []seccompVerdict{{Action: b.seccomp.DefaultAction}}
+			}
+			if verdictsString(f) == verdictsString(t) {
+				continue
+			}
+
+			var change string
+			switch fl, tl := allowLevel(f), allowLevel(t); {
+			case tl > fl && tl == 2:
+				change = "allowed"
+			case tl > fl:
+				change = "conditionally allowed"
+			case tl < fl && tl == 0:
+				change = "denied"
+			case tl < fl:
+				change = "restricted"
+			default:
+				change = "changed"
+			}
+			changes = append(changes, seccompChange{
+				Arch:    arch,
+				Syscall: name,
+				Change:  change,
+				From:    f,
+				To:      t,
+			})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Arch != changes[j].Arch {
+			return changes[i].Arch < changes[j].Arch
+		}
+		return changes[i].Syscall < changes[j].Syscall
+	})
+	return changes
+}
+
+func verdictsString(verdicts []seccompVerdict) string {
+	s := make([]string, 0, len(verdicts))
+	for _, v := range verdicts {
+		s = append(s, v.String())
+	}
+	sort.Strings(s)
+	return strings.Join(s, " | ")
+}
+
+func printSeccompChanges(out io.Writer, changes []seccompChange) {
+	if len(changes) == 0 {
+		fmt.Fprintln(out, "no differences")
+		return
+	}
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ARCH\tSYSCALL\tCHANGE\tFROM\tTO")
+	for _, c := range changes {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", c.Arch, c.Syscall, c.Change, verdictsString(c.From), verdictsString(c.To))
+	}
+	w.Flush()
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// seccompTargets loads the builtin default profile and the weak overlay, as
+// seen by a container with caps.
+func seccompTargets(t *testing.T, caps ...string) (*seccompTarget, *seccompTarget) {
+	t.Helper()
+	a, err := loadSeccomp("default", ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := loadSeccomp("profiles/seccomp/weak.json", ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := normalizeCapabilities(append(defaultCapabilities, caps...))
+	return &seccompTarget{seccomp: a, caps: c}, &seccompTarget{seccomp: b, caps: c}
+}
+
+func TestDiffSeccomp(t *testing.T) {
+	a, b := seccompTargets(t)
+	changes := diffSeccomp(a, b, []string{"amd64", "x32"})
+	var got []string
+	for _, c := range changes {
+		got = append(got, c.Arch+" "+c.Syscall+" "+c.Change+": "+verdictsString(c.From)+" -> "+verdictsString(c.To))
+	}
+	want := []string{
+		"amd64 unshare allowed: SCMP_ACT_ERRNO -> SCMP_ACT_ALLOW",
+		"x32 unshare allowed: SCMP_ACT_ERRNO -> SCMP_ACT_ALLOW",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected changes\n%q\ngot\n%q", want, got)
+	}
+
+	// with CAP_SYS_ADMIN the default profile allows unshare too
+	a, b = seccompTargets(t, "SYS_ADMIN")
+	if changes := diffSeccomp(a, b, []string{"amd64"}); len(changes) != 0 {
+		t.Errorf("expected no changes with CAP_SYS_ADMIN, got %+v", changes)
+	}
+}
+
+func TestDiffSeccompArgs(t *testing.T) {
+	a, err := parseSeccomp(strings.NewReader(`{"defaultAction": "SCMP_ACT_ERRNO", "syscalls": [
+		{"names": ["personality"], "action": "SCMP_ACT_ALLOW", "args": []},
+		{"names": ["ptrace"], "action": "SCMP_ACT_ALLOW", "args": [], "excludes": {"arches": ["amd64"]}}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := parseSeccomp(strings.NewReader(`{"defaultAction": "SCMP_ACT_ERRNO", "syscalls": [
+		{"names": ["personality"], "action": "SCMP_ACT_ALLOW", "args": [{"index": 0, "value": 8, "valueTwo": 0, "op": "SCMP_CMP_EQ"}]},
+		{"names": ["ptrace"], "action": "SCMP_ACT_ALLOW", "args": []}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	caps := normalizeCapabilities(defaultCapabilities)
+	changes := diffSeccomp(&seccompTarget{a, caps}, &seccompTarget{b, caps}, []string{"amd64", "arm64"})
+	var got []string
+	for _, c := range changes {
+		got = append(got, c.Arch+" "+c.Syscall+" "+c.Change+": "+verdictsString(c.To))
+	}
+	want := []string{
+		"amd64 personality restricted: SCMP_ACT_ALLOW if arg0 EQ 0x8",
+		"amd64 ptrace allowed: SCMP_ACT_ALLOW",
+		"arm64 personality restricted: SCMP_ACT_ALLOW if arg0 EQ 0x8",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected changes\n%q\ngot\n%q", want, got)
+	}
+}
+
+func TestPrintSeccompChanges(t *testing.T) {
+	a, b := seccompTargets(t)
+	changes := diffSeccomp(a, b, []string{"amd64"})
+
+	var out bytes.Buffer
+	printSeccompChanges(&out, changes)
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 || strings.Join(strings.Fields(lines[0]), " ") != "ARCH SYSCALL CHANGE FROM TO" ||
+		strings.Join(strings.Fields(lines[1]), " ") != "amd64 unshare allowed SCMP_ACT_ERRNO SCMP_ACT_ALLOW" {
+		t.Errorf("unexpected output:\n%s", out.String())
+	}
+
+	out.Reset()
+	printSeccompChanges(&out, diffSeccomp(a, a, []string{"amd64"}))
+	if out.String() != "no differences\n" {
+		t.Errorf("expected no differences, got %q", out.String())
+	}
+
+	b2, err := json.Marshal(changes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `[{"arch":"amd64","syscall":"unshare","change":"allowed","from":[{"action":"SCMP_ACT_ERRNO"}],"to":[{"action":"SCMP_ACT_ALLOW"}]}]`
+	if string(b2) != want {
+		t.Errorf("expected JSON\n%s\ngot\n%s", want, b2)
+	}
+}
+
+func TestProfileArches(t *testing.T) {
+	s, err := parseSeccomp(strings.NewReader(`{"defaultAction": "SCMP_ACT_ERRNO", "archMap": [
+		{"architecture": "SCMP_ARCH_X86_64", "subArchitectures": ["SCMP_ARCH_X86", "SCMP_ARCH_X32"]},
+		{"architecture": "SCMP_ARCH_AARCH64", "subArchitectures": ["SCMP_ARCH_ARM"]}
+	], "syscalls": []}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := profileArches(s); !reflect.DeepEqual(got, []string{"386", "amd64", "arm", "arm64"}) {
+		t.Errorf("expected the architectures and subarchitectures, got %q", got)
+	}
+}
+
+func TestLoadSeccompTarget(t *testing.T) {
+	// a docker profile named like the builtin default seccomp profile
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "seccomp"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for from, to := range map[string]string{
+		"profiles/weak-docker.json":  "default.json",
+		"profiles/seccomp/weak.json": "seccomp/weak.json",
+	} {
+		b, err := ioutil.ReadFile(from)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, to), b, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer func(dir string) { profilesDir = dir }(profilesDir)
+
+	for _, tc := range []struct {
+		dir, ref string
+		// unshare are the verdicts for unshare without CAP_SYS_ADMIN
+		unshare string
+		caps    []string
+	}{
+		// the docker profile wins, with its own capabilities
+		{dir, "default", "SCMP_ACT_ALLOW", []string{"CAP_NET_ADMIN", "CAP_SYS_PTRACE"}},
+		// without it the builtin profile is used
+		{t.TempDir(), "default", "", nil},
+		{t.TempDir(), "profiles/seccomp/weak.json", "SCMP_ACT_ALLOW", nil},
+	} {
+		profilesDir = tc.dir
+		target, err := loadSeccompTarget(tc.ref)
+		if err != nil {
+			t.Fatalf("%s in %s: %v", tc.ref, tc.dir, err)
+		}
+		verdicts := target.seccomp.effective("amd64", normalizeCapabilities(defaultCapabilities))
+		if got := verdictsString(verdicts["unshare"]); got != tc.unshare {
+			t.Errorf("%s in %s: expected unshare verdicts %q, got %q", tc.ref, tc.dir, tc.unshare, got)
+		}
+		for _, c := range tc.caps {
+			if _, ok := target.caps[c]; !ok {
+				t.Errorf("%s in %s: expected capability %s", tc.ref, tc.dir, c)
+			}
+		}
+	}
+}
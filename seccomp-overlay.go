@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// seccompOverlay defines a seccomp profile as a base profile plus overrides,
+// so variants of a profile only spell out how they differ from it.
+//
+// Every syscall named by the overlay is first removed from all the rules of
+// the base profile, then:
+//   - Allow adds a rule allowing the syscalls unconditionally.
+//   - Deny adds a rule denying the syscalls, unless they are already denied
+//     by the default action.
+//   - Rules are appended as they are, to allow syscalls depending on their
+//     arguments, capabilities or architectures.
+type seccompOverlay struct {
+	// Base is the name of a builtin seccomp profile or the path to a
+	// seccomp profile or overlay file, relative to the overlay.
+	Base    string           `json:"base"`
+	Comment string           `json:"comment,omitempty"`
+	Allow   []string         `json:"allow,omitempty"`
+	Deny    []string         `json:"deny,omitempty"`
+	Rules   []seccompSyscall `json:"rules,omitempty"`
+}
+
+// isSeccompOverlay returns whether b holds a seccompOverlay rather than a
+// full seccomp profile.
+func isSeccompOverlay(b []byte) bool {
+	var probe struct {
+		Base string `json:"base"`
+	}
+	return json.Unmarshal(b, &probe) == nil && probe.Base != ""
+}
+
+// resolveSeccompOverlay parses the overlay in r and returns the effective
+// seccomp profile.
+func resolveSeccompOverlay(r io.Reader, dir string, seen []string) (*seccompProfile, error) {
+	var o seccompOverlay
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&o); err != nil {
+		return nil, err
+	}
+
+	base, err := resolveSeccomp(o.Base, dir, seen)
+	if err != nil {
+		return nil, fmt.Errorf("base: %v", err)
+	}
+
+	s := o.apply(base)
+	if err := s.validate(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// apply returns the effective profile of the overlay on top of base. base is
+// left untouched.
+func (o *seccompOverlay) apply(base *seccompProfile) *seccompProfile {
+	var rules []seccompSyscall
+	if len(o.Allow) > 0 {
+		rules = append(rules, seccompSyscall{
+			Names:   o.Allow,
+			Action:  "SCMP_ACT_ALLOW",
+			Args:    []seccompArg{},
+			Comment: o.Comment,
+		})
+	}
+	if len(o.Deny) > 0 && base.DefaultAction != "SCMP_ACT_ERRNO" {
+		rules = append(rules, seccompSyscall{
+			Names:   o.Deny,
+			Action:  "SCMP_ACT_ERRNO",
+			Args:    []seccompArg{},
+			Comment: o.Comment,
+		})
+	}
+	rules = append(rules, o.Rules...)
+
+	overridden := map[string]struct{}{}
+	for _, name := range o.Deny {
+		overridden[name] = struct{}{}
+	}
+	for _, rule := range rules {
+		for _, name := range rule.syscalls() {
+			overridden[name] = struct{}{}
+		}
+	}
+
+	s := &seccompProfile{
+		DefaultAction:   base.DefaultAction,
+		DefaultErrnoRet: base.DefaultErrnoRet,
+		ArchMap:         base.ArchMap,
+	}
+	for _, rule := range base.Syscalls {
+		var names []string
+		for _, name := range rule.syscalls() {
+			if _, ok := overridden[name]; !ok {
+				names = append(names, name)
+			}
+		}
+		if len(names) == 0 {
+			continue
+		}
+		rule.Name = ""
+		rule.Names = names
+		s.Syscalls = append(s.Syscalls, rule)
+	}
+	s.Syscalls = append(s.Syscalls, rules...)
+
+	return s
+}
+
+// syscalls returns the syscalls the rule applies to.
+func (sc *seccompSyscall) syscalls() []string {
+	if sc.Name != "" {
+		return []string{sc.Name}
+	}
+	return sc.Names
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// describeRules returns the rules of s in a short form, their action, the
+// syscalls they name and the capabilities they need.
+func describeRules(s *seccompProfile) []string {
+	var rules []string
+	for _, rule := range s.Syscalls {
+		desc := rule.Action + " " + strings.Join(rule.syscalls(), ",")
+		if len(rule.Args) > 0 {
+			desc += " if args"
+		}
+		if len(rule.Includes.Caps) > 0 {
+			desc += " with " + strings.Join(rule.Includes.Caps, ",")
+		}
+		rules = append(rules, desc)
+	}
+	return rules
+}
+
+func TestSeccompOverlayApply(t *testing.T) {
+	base := `{
+		"defaultAction": "SCMP_ACT_ERRNO",
+		"defaultErrnoRet": 1,
+		"syscalls": [
+			{"names": ["read", "write", "unshare"], "action": "SCMP_ACT_ALLOW", "args": []},
+			{"names": ["ptrace", "mount"], "action": "SCMP_ACT_ALLOW", "args": [], "includes": {"caps": ["CAP_SYS_ADMIN"]}}
+		]
+	}`
+	personality := seccompSyscall{
+		Names:  []string{"personality"},
+		Action: "SCMP_ACT_ALLOW",
+		Args:   []seccompArg{{Index: 0, Value: 8, Op: "SCMP_CMP_EQ"}},
+	}
+
+	for _, tc := range []struct {
+		name    string
+		overlay seccompOverlay
+		want    []string
+	}{
+		{
+			name:    "allow",
+			overlay: seccompOverlay{Allow: []string{"ptrace"}},
+			want: []string{
+				"SCMP_ACT_ALLOW read,write,unshare",
+				"SCMP_ACT_ALLOW mount with CAP_SYS_ADMIN",
+				"SCMP_ACT_ALLOW ptrace",
+			},
+		},
+		{
+			name:    "allow every syscall of a rule",
+			overlay: seccompOverlay{Allow: []string{"ptrace", "mount"}},
+			want: []string{
+				"SCMP_ACT_ALLOW read,write,unshare",
+				"SCMP_ACT_ALLOW ptrace,mount",
+			},
+		},
+		{
+			// the default action already denies it
+			name:    "deny",
+			overlay: seccompOverlay{Deny: []string{"unshare", "mount"}},
+			want: []string{
+				"SCMP_ACT_ALLOW read,write",
+				"SCMP_ACT_ALLOW ptrace with CAP_SYS_ADMIN",
+			},
+		},
+		{
+			name:    "rules",
+			overlay: seccompOverlay{Rules: []seccompSyscall{personality}},
+			want: []string{
+				"SCMP_ACT_ALLOW read,write,unshare",
+				"SCMP_ACT_ALLOW ptrace,mount with CAP_SYS_ADMIN",
+				"SCMP_ACT_ALLOW personality if args",
+			},
+		},
+		{
+			// rules override the syscalls they name like allow and deny
+			name: "rules override",
+			overlay: seccompOverlay{Rules: []seccompSyscall{{
+				Names:    []string{"unshare"},
+				Action:   "SCMP_ACT_ALLOW",
+				Args:     []seccompArg{},
+				Includes: seccompFilter{Caps: []string{"CAP_SYS_ADMIN"}},
+			}}},
+			want: []string{
+				"SCMP_ACT_ALLOW read,write",
+				"SCMP_ACT_ALLOW ptrace,mount with CAP_SYS_ADMIN",
+				"SCMP_ACT_ALLOW unshare with CAP_SYS_ADMIN",
+			},
+		},
+		{
+			// the base rules come first, then allow, deny and rules
+			name: "order",
+			overlay: seccompOverlay{
+				Allow: []string{"mount"},
+				Deny:  []string{"write"},
+				Rules: []seccompSyscall{personality},
+			},
+			want: []string{
+				"SCMP_ACT_ALLOW read,unshare",
+				"SCMP_ACT_ALLOW ptrace with CAP_SYS_ADMIN",
+				"SCMP_ACT_ALLOW mount",
+				"SCMP_ACT_ALLOW personality if args",
+			},
+		},
+	} {
+		s, err := parseSeccomp(strings.NewReader(base))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := tc.overlay.apply(s)
+		if !reflect.DeepEqual(describeRules(got), tc.want) {
+			t.Errorf("%s: expected rules\n%q\ngot\n%q", tc.name, tc.want, describeRules(got))
+		}
+		if got.DefaultAction != "SCMP_ACT_ERRNO" || got.DefaultErrnoRet == nil || *got.DefaultErrnoRet != 1 {
+			t.Errorf("%s: expected the default action of the base, got %s", tc.name, got.DefaultAction)
+		}
+		if err := got.validate(); err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+		}
+		if rules := describeRules(s); len(rules) != 2 || rules[0] != "SCMP_ACT_ALLOW read,write,unshare" {
+			t.Errorf("%s: the base profile changed: %q", tc.name, rules)
+		}
+	}
+
+	// denying needs a rule when the default action allows
+	s, err := parseSeccomp(strings.NewReader(`{"defaultAction": "SCMP_ACT_ALLOW", "syscalls": []}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	o := seccompOverlay{Deny: []string{"ptrace"}}
+	if got := describeRules(o.apply(s)); !reflect.DeepEqual(got, []string{"SCMP_ACT_ERRNO ptrace"}) {
+		t.Errorf("expected a rule denying ptrace, got %q", got)
+	}
+}
+
+// seccompRules returns the rules of s by syscall, encoded without their
+// names and comments, so profiles grouping their syscalls differently
+// compare equal.
+func seccompRules(t *testing.T, s *seccompProfile) map[string][]string {
+	t.Helper()
+	rules := map[string][]string{}
+	for _, rule := range s.Syscalls {
+		names := rule.syscalls()
+		rule.Name, rule.Names, rule.Comment = "", nil, ""
+		b, err := json.Marshal(rule)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range names {
+			rules[name] = append(rules[name], string(b))
+		}
+	}
+	for _, r := range rules {
+		sort.Strings(r)
+	}
+	return rules
+}
+
+// TestSeccompOverlayWeak checks the weak overlay gives the weak profile that
+// was kept in full before overlays.
+func TestSeccompOverlayWeak(t *testing.T) {
+	got, err := loadSeccomp("seccomp/weak.json", "profiles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open("testdata/seccomp-weak.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	want, err := parseSeccomp(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.DefaultAction != want.DefaultAction || !reflect.DeepEqual(got.ArchMap, want.ArchMap) {
+		t.Errorf("expected default action %s and archMap %v, got %s and %v", want.DefaultAction, want.ArchMap, got.DefaultAction, got.ArchMap)
+	}
+	gotRules, wantRules := seccompRules(t, got), seccompRules(t, want)
+	for name, rules := range wantRules {
+		if !reflect.DeepEqual(gotRules[name], rules) {
+			t.Errorf("%s: expected rules\n%q\ngot\n%q", name, rules, gotRules[name])
+		}
+	}
+	for name := range gotRules {
+		if _, ok := wantRules[name]; !ok {
+			t.Errorf("%s: unexpected rules %q", name, gotRules[name])
+		}
+	}
+}
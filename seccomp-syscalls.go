@@ -0,0 +1,639 @@
+// Code generated by go run mksyscalls.go; DO NOT EDIT.
+
+package main
+
+// syscallNames holds the space separated syscall names of every
+// architecture, keyed by GOARCH.
+var syscallNames = map[string]string{
+	"386": `_llseek _newselect _sysctl accept4 access acct add_key adjtimex
+afs_syscall alarm arch_prctl bdflush bind bpf break brk capget capset
+chdir chmod chown chown32 chroot clock_adjtime clock_getres clock_gettime
+clock_nanosleep clock_settime clone close connect copy_file_range creat
+create_module delete_module dup dup2 dup3 epoll_create epoll_create1
+epoll_ctl epoll_pwait epoll_wait eventfd eventfd2 execve execveat exit
+exit_group faccessat fadvise64 fadvise64_64 fallocate fanotify_init
+fanotify_mark fchdir fchmod fchmodat fchown fchown32 fchownat fcntl
+fcntl64 fdatasync fgetxattr finit_module flistxattr flock fork
+fremovexattr fsetxattr fstat fstat64 fstatat64 fstatfs fstatfs64 fsync
+ftime ftruncate ftruncate64 futex futimesat get_kernel_syms get_mempolicy
+get_robust_list get_thread_area getcpu getcwd getdents getdents64 getegid
+getegid32 geteuid geteuid32 getgid getgid32 getgroups getgroups32
+getitimer getpeername getpgid getpgrp getpid getpmsg getppid getpriority
+getrandom getresgid getresgid32 getresuid getresuid32 getrlimit getrusage
+getsid getsockname getsockopt gettid gettimeofday getuid getuid32
+getxattr gtty idle init_module inotify_add_watch inotify_init
+inotify_init1 inotify_rm_watch io_cancel io_destroy io_getevents
+io_pgetevents io_setup io_submit ioctl ioperm iopl ioprio_get ioprio_set
+ipc kcmp kexec_load keyctl kill lchown lchown32 lgetxattr link linkat
+listen listxattr llistxattr lock lookup_dcookie lremovexattr lseek
+lsetxattr lstat lstat64 madvise mbind membarrier memfd_create
+migrate_pages mincore mkdir mkdirat mknod mknodat mlock mlock2 mlockall
+mmap mmap2 modify_ldt mount move_pages mprotect mpx mq_getsetattr
+mq_notify mq_open mq_timedreceive mq_timedsend mq_unlink mremap msync
+munlock munlockall munmap name_to_handle_at nanosleep nfsservctl nice
+oldfstat oldlstat oldolduname oldstat olduname open open_by_handle_at
+openat pause perf_event_open personality pipe pipe2 pivot_root pkey_alloc
+pkey_free pkey_mprotect poll ppoll prctl pread64 preadv preadv2 prlimit64
+process_vm_readv process_vm_writev prof profil pselect6 ptrace putpmsg
+pwrite64 pwritev pwritev2 query_module quotactl read readahead readdir
+readlink readlinkat readv reboot recvfrom recvmmsg recvmsg
+remap_file_pages removexattr rename renameat renameat2 request_key
+restart_syscall rmdir rseq rt_sigaction rt_sigpending rt_sigprocmask
+rt_sigqueueinfo rt_sigreturn rt_sigsuspend rt_sigtimedwait
+rt_tgsigqueueinfo sched_get_priority_max sched_get_priority_min
+sched_getaffinity sched_getattr sched_getparam sched_getscheduler
+sched_rr_get_interval sched_setaffinity sched_setattr sched_setparam
+sched_setscheduler sched_yield seccomp select sendfile sendfile64
+sendmmsg sendmsg sendto set_mempolicy set_robust_list set_thread_area
+set_tid_address setdomainname setfsgid setfsgid32 setfsuid setfsuid32
+setgid setgid32 setgroups setgroups32 sethostname setitimer setns setpgid
+setpriority setregid setregid32 setresgid setresgid32 setresuid
+setresuid32 setreuid setreuid32 setrlimit setsid setsockopt settimeofday
+setuid setuid32 setxattr sgetmask shutdown sigaction sigaltstack signal
+signalfd signalfd4 sigpending sigprocmask sigreturn sigsuspend socket
+socketcall socketpair splice ssetmask stat stat64 statfs statfs64 statx
+stime stty swapoff swapon symlink symlinkat sync sync_file_range syncfs
+sysfs sysinfo syslog tee tgkill time timer_create timer_delete
+timer_getoverrun timer_gettime timer_settime timerfd_create
+timerfd_gettime timerfd_settime times tkill truncate truncate64
+ugetrlimit ulimit umask umount umount2 uname unlink unlinkat unshare
+uselib userfaultfd ustat utime utimensat utimes vfork vhangup vm86
+vm86old vmsplice vserver wait4 waitid waitpid write writev`,
+	"amd64": `_sysctl accept accept4 access acct add_key adjtimex afs_syscall alarm
+arch_prctl bind bpf brk capget capset chdir chmod chown chroot
+clock_adjtime clock_getres clock_gettime clock_nanosleep clock_settime
+clone close connect copy_file_range creat create_module delete_module dup
+dup2 dup3 epoll_create epoll_create1 epoll_ctl epoll_ctl_old epoll_pwait
+epoll_wait epoll_wait_old eventfd eventfd2 execve execveat exit
+exit_group faccessat fadvise64 fallocate fanotify_init fanotify_mark
+fchdir fchmod fchmodat fchown fchownat fcntl fdatasync fgetxattr
+finit_module flistxattr flock fork fremovexattr fsetxattr fstat fstatfs
+fsync ftruncate futex futimesat get_kernel_syms get_mempolicy
+get_robust_list get_thread_area getcpu getcwd getdents getdents64 getegid
+geteuid getgid getgroups getitimer getpeername getpgid getpgrp getpid
+getpmsg getppid getpriority getrandom getresgid getresuid getrlimit
+getrusage getsid getsockname getsockopt gettid gettimeofday getuid
+getxattr init_module inotify_add_watch inotify_init inotify_init1
+inotify_rm_watch io_cancel io_destroy io_getevents io_pgetevents io_setup
+io_submit ioctl ioperm iopl ioprio_get ioprio_set kcmp kexec_file_load
+kexec_load keyctl kill lchown lgetxattr link linkat listen listxattr
+llistxattr lookup_dcookie lremovexattr lseek lsetxattr lstat madvise
+mbind membarrier memfd_create migrate_pages mincore mkdir mkdirat mknod
+mknodat mlock mlock2 mlockall mmap modify_ldt mount move_pages mprotect
+mq_getsetattr mq_notify mq_open mq_timedreceive mq_timedsend mq_unlink
+mremap msgctl msgget msgrcv msgsnd msync munlock munlockall munmap
+name_to_handle_at nanosleep newfstatat nfsservctl open open_by_handle_at
+openat pause perf_event_open personality pipe pipe2 pivot_root pkey_alloc
+pkey_free pkey_mprotect poll ppoll prctl pread64 preadv preadv2 prlimit64
+process_vm_readv process_vm_writev pselect6 ptrace putpmsg pwrite64
+pwritev pwritev2 query_module quotactl read readahead readlink readlinkat
+readv reboot recvfrom recvmmsg recvmsg remap_file_pages removexattr
+rename renameat renameat2 request_key restart_syscall rmdir rseq
+rt_sigaction rt_sigpending rt_sigprocmask rt_sigqueueinfo rt_sigreturn
+rt_sigsuspend rt_sigtimedwait rt_tgsigqueueinfo sched_get_priority_max
+sched_get_priority_min sched_getaffinity sched_getattr sched_getparam
+sched_getscheduler sched_rr_get_interval sched_setaffinity sched_setattr
+sched_setparam sched_setscheduler sched_yield seccomp security select
+semctl semget semop semtimedop sendfile sendmmsg sendmsg sendto
+set_mempolicy set_robust_list set_thread_area set_tid_address
+setdomainname setfsgid setfsuid setgid setgroups sethostname setitimer
+setns setpgid setpriority setregid setresgid setresuid setreuid setrlimit
+setsid setsockopt settimeofday setuid setxattr shmat shmctl shmdt shmget
+shutdown sigaltstack signalfd signalfd4 socket socketpair splice stat
+statfs statx swapoff swapon symlink symlinkat sync sync_file_range syncfs
+sysfs sysinfo syslog tee tgkill time timer_create timer_delete
+timer_getoverrun timer_gettime timer_settime timerfd_create
+timerfd_gettime timerfd_settime times tkill truncate tuxcall umask
+umount2 uname unlink unlinkat unshare uselib userfaultfd ustat utime
+utimensat utimes vfork vhangup vmsplice vserver wait4 waitid write writev`,
+	"arm": `_llseek _newselect _sysctl accept accept4 access acct add_key adjtimex
+arm_fadvise64_64 arm_sync_file_range bdflush bind bpf breakpoint brk
+cacheflush capget capset chdir chmod chown chown32 chroot clock_adjtime
+clock_getres clock_gettime clock_nanosleep clock_settime clone close
+connect copy_file_range creat delete_module dup dup2 dup3 epoll_create
+epoll_create1 epoll_ctl epoll_pwait epoll_wait eventfd eventfd2 execve
+execveat exit exit_group faccessat fallocate fanotify_init fanotify_mark
+fchdir fchmod fchmodat fchown fchown32 fchownat fcntl fcntl64 fdatasync
+fgetxattr finit_module flistxattr flock fork fremovexattr fsetxattr fstat
+fstat64 fstatat64 fstatfs fstatfs64 fsync ftruncate ftruncate64 futex
+futimesat get_mempolicy get_robust_list getcpu getcwd getdents getdents64
+getegid getegid32 geteuid geteuid32 getgid getgid32 getgroups getgroups32
+getitimer getpeername getpgid getpgrp getpid getppid getpriority
+getrandom getresgid getresgid32 getresuid getresuid32 getrusage getsid
+getsockname getsockopt gettid gettimeofday getuid getuid32 getxattr
+init_module inotify_add_watch inotify_init inotify_init1 inotify_rm_watch
+io_cancel io_destroy io_getevents io_setup io_submit ioctl ioprio_get
+ioprio_set kcmp kexec_load keyctl kill lchown lchown32 lgetxattr link
+linkat listen listxattr llistxattr lookup_dcookie lremovexattr lseek
+lsetxattr lstat lstat64 madvise mbind membarrier memfd_create mincore
+mkdir mkdirat mknod mknodat mlock mlock2 mlockall mmap2 mount move_pages
+mprotect mq_getsetattr mq_notify mq_open mq_timedreceive mq_timedsend
+mq_unlink mremap msgctl msgget msgrcv msgsnd msync munlock munlockall
+munmap name_to_handle_at nanosleep nfsservctl nice open open_by_handle_at
+openat pause pciconfig_iobase pciconfig_read pciconfig_write
+perf_event_open personality pipe pipe2 pivot_root pkey_alloc pkey_free
+pkey_mprotect poll ppoll prctl pread64 preadv preadv2 prlimit64
+process_vm_readv process_vm_writev pselect6 ptrace pwrite64 pwritev
+pwritev2 quotactl read readahead readlink readlinkat readv reboot recv
+recvfrom recvmmsg recvmsg remap_file_pages removexattr rename renameat
+renameat2 request_key restart_syscall rmdir rseq rt_sigaction
+rt_sigpending rt_sigprocmask rt_sigqueueinfo rt_sigreturn rt_sigsuspend
+rt_sigtimedwait rt_tgsigqueueinfo sched_get_priority_max
+sched_get_priority_min sched_getaffinity sched_getattr sched_getparam
+sched_getscheduler sched_rr_get_interval sched_setaffinity sched_setattr
+sched_setparam sched_setscheduler sched_yield seccomp semctl semget semop
+semtimedop send sendfile sendfile64 sendmmsg sendmsg sendto set_mempolicy
+set_robust_list set_tid_address set_tls setdomainname setfsgid setfsgid32
+setfsuid setfsuid32 setgid setgid32 setgroups setgroups32 sethostname
+setitimer setns setpgid setpriority setregid setregid32 setresgid
+setresgid32 setresuid setresuid32 setreuid setreuid32 setrlimit setsid
+setsockopt settimeofday setuid setuid32 setxattr shmat shmctl shmdt
+shmget shutdown sigaction sigaltstack signalfd signalfd4 sigpending
+sigprocmask sigreturn sigsuspend socket socketpair splice stat stat64
+statfs statfs64 statx swapoff swapon symlink symlinkat sync
+sync_file_range2 syncfs sysfs sysinfo syslog tee tgkill timer_create
+timer_delete timer_getoverrun timer_gettime timer_settime timerfd_create
+timerfd_gettime timerfd_settime times tkill truncate truncate64
+ugetrlimit umask umount2 uname unlink unlinkat unshare uselib userfaultfd
+usr26 usr32 ustat utimensat utimes vfork vhangup vmsplice vserver wait4
+waitid write writev`,
+	"arm64": `accept accept4 acct add_key adjtimex arch_specific_syscall bind bpf brk
+capget capset chdir chroot clock_adjtime clock_getres clock_gettime
+clock_nanosleep clock_settime clone close connect copy_file_range
+delete_module dup dup3 epoll_create1 epoll_ctl epoll_pwait eventfd2
+execve execveat exit exit_group faccessat fadvise64 fallocate
+fanotify_init fanotify_mark fchdir fchmod fchmodat fchown fchownat fcntl
+fdatasync fgetxattr finit_module flistxattr flock fremovexattr fsetxattr
+fstat fstatat fstatfs fsync ftruncate futex get_mempolicy get_robust_list
+getcpu getcwd getdents64 getegid geteuid getgid getgroups getitimer
+getpeername getpgid getpid getppid getpriority getrandom getresgid
+getresuid getrlimit getrusage getsid getsockname getsockopt gettid
+gettimeofday getuid getxattr init_module inotify_add_watch inotify_init1
+inotify_rm_watch io_cancel io_destroy io_getevents io_pgetevents io_setup
+io_submit ioctl ioprio_get ioprio_set kcmp kexec_load keyctl kill
+lgetxattr linkat listen listxattr llistxattr lookup_dcookie lremovexattr
+lseek lsetxattr madvise mbind membarrier memfd_create migrate_pages
+mincore mkdirat mknodat mlock mlock2 mlockall mmap mount move_pages
+mprotect mq_getsetattr mq_notify mq_open mq_timedreceive mq_timedsend
+mq_unlink mremap msgctl msgget msgrcv msgsnd msync munlock munlockall
+munmap name_to_handle_at nanosleep nfsservctl open_by_handle_at openat
+perf_event_open personality pipe2 pivot_root pkey_alloc pkey_free
+pkey_mprotect ppoll prctl pread64 preadv preadv2 prlimit64
+process_vm_readv process_vm_writev pselect6 ptrace pwrite64 pwritev
+pwritev2 quotactl read readahead readlinkat readv reboot recvfrom
+recvmmsg recvmsg remap_file_pages removexattr renameat renameat2
+request_key restart_syscall rt_sigaction rt_sigpending rt_sigprocmask
+rt_sigqueueinfo rt_sigreturn rt_sigsuspend rt_sigtimedwait
+rt_tgsigqueueinfo sched_get_priority_max sched_get_priority_min
+sched_getaffinity sched_getattr sched_getparam sched_getscheduler
+sched_rr_get_interval sched_setaffinity sched_setattr sched_setparam
+sched_setscheduler sched_yield seccomp semctl semget semop semtimedop
+sendfile sendmmsg sendmsg sendto set_mempolicy set_robust_list
+set_tid_address setdomainname setfsgid setfsuid setgid setgroups
+sethostname setitimer setns setpgid setpriority setregid setresgid
+setresuid setreuid setrlimit setsid setsockopt settimeofday setuid
+setxattr shmat shmctl shmdt shmget shutdown sigaltstack signalfd4 socket
+socketpair splice statfs statx swapoff swapon symlinkat sync
+sync_file_range syncfs sysinfo syslog tee tgkill timer_create
+timer_delete timer_getoverrun timer_gettime timer_settime timerfd_create
+timerfd_gettime timerfd_settime times tkill truncate umask umount2 uname
+unlinkat unshare userfaultfd utimensat vhangup vmsplice wait4 waitid
+write writev`,
+	"mips": `_llseek _newselect _sysctl accept accept4 access acct add_key adjtimex
+afs_syscall alarm bdflush bind bpf break brk cachectl cacheflush capget
+capset chdir chmod chown chroot clock_adjtime clock_getres clock_gettime
+clock_nanosleep clock_settime clone close connect copy_file_range creat
+create_module delete_module dup dup2 dup3 epoll_create epoll_create1
+epoll_ctl epoll_pwait epoll_wait eventfd eventfd2 execve execveat exit
+exit_group faccessat fadvise64 fallocate fanotify_init fanotify_mark
+fchdir fchmod fchmodat fchown fchownat fcntl fcntl64 fdatasync fgetxattr
+finit_module flistxattr flock fork fremovexattr fsetxattr fstat fstat64
+fstatat64 fstatfs fstatfs64 fsync ftime ftruncate ftruncate64 futex
+futimesat get_kernel_syms get_mempolicy get_robust_list getcpu getcwd
+getdents getdents64 getegid geteuid getgid getgroups getitimer
+getpeername getpgid getpgrp getpid getpmsg getppid getpriority getrandom
+getresgid getresuid getrlimit getrusage getsid getsockname getsockopt
+gettid gettimeofday getuid getxattr gtty idle init_module
+inotify_add_watch inotify_init inotify_init1 inotify_rm_watch io_cancel
+io_destroy io_getevents io_pgetevents io_setup io_submit ioctl ioperm
+iopl ioprio_get ioprio_set ipc kcmp kexec_load keyctl kill lchown
+lgetxattr link linkat listen listxattr llistxattr lock lookup_dcookie
+lremovexattr lseek lsetxattr lstat lstat64 madvise mbind membarrier
+memfd_create migrate_pages mincore mkdir mkdirat mknod mknodat mlock
+mlock2 mlockall mmap mmap2 modify_ldt mount move_pages mprotect mpx
+mq_getsetattr mq_notify mq_open mq_timedreceive mq_timedsend mq_unlink
+mremap msync munlock munlockall munmap name_to_handle_at nanosleep
+nfsservctl nice open open_by_handle_at openat pause perf_event_open
+personality pipe pipe2 pivot_root pkey_alloc pkey_free pkey_mprotect poll
+ppoll prctl pread64 preadv preadv2 prlimit64 process_vm_readv
+process_vm_writev prof profil pselect6 ptrace putpmsg pwrite64 pwritev
+pwritev2 query_module quotactl read readahead readdir readlink readlinkat
+readv reboot recv recvfrom recvmmsg recvmsg remap_file_pages removexattr
+rename renameat renameat2 request_key reserved221 reserved82
+restart_syscall rmdir rseq rt_sigaction rt_sigpending rt_sigprocmask
+rt_sigqueueinfo rt_sigreturn rt_sigsuspend rt_sigtimedwait
+rt_tgsigqueueinfo sched_get_priority_max sched_get_priority_min
+sched_getaffinity sched_getattr sched_getparam sched_getscheduler
+sched_rr_get_interval sched_setaffinity sched_setattr sched_setparam
+sched_setscheduler sched_yield seccomp send sendfile sendfile64 sendmmsg
+sendmsg sendto set_mempolicy set_robust_list set_thread_area
+set_tid_address setdomainname setfsgid setfsuid setgid setgroups
+sethostname setitimer setns setpgid setpriority setregid setresgid
+setresuid setreuid setrlimit setsid setsockopt settimeofday setuid
+setxattr sgetmask shutdown sigaction sigaltstack signal signalfd
+signalfd4 sigpending sigprocmask sigreturn sigsuspend socket socketcall
+socketpair splice ssetmask stat stat64 statfs statfs64 statx stime stty
+swapoff swapon symlink symlinkat sync sync_file_range syncfs syscall
+sysfs sysinfo syslog sysmips tee tgkill time timer_create timer_delete
+timer_getoverrun timer_gettime timer_settime timerfd timerfd_create
+timerfd_gettime timerfd_settime times tkill truncate truncate64 ulimit
+umask umount umount2 uname unlink unlinkat unshare unused109 unused150
+unused18 unused28 unused59 unused84 uselib userfaultfd ustat utime
+utimensat utimes vhangup vm86 vmsplice vserver wait4 waitid waitpid write
+writev`,
+	"mips64": `_newselect _sysctl accept accept4 access acct add_key adjtimex
+afs_syscall alarm bind bpf brk cachectl cacheflush capget capset chdir
+chmod chown chroot clock_adjtime clock_getres clock_gettime
+clock_nanosleep clock_settime clone close connect copy_file_range creat
+create_module delete_module dup dup2 dup3 epoll_create epoll_create1
+epoll_ctl epoll_pwait epoll_wait eventfd eventfd2 execve execveat exit
+exit_group faccessat fadvise64 fallocate fanotify_init fanotify_mark
+fchdir fchmod fchmodat fchown fchownat fcntl fdatasync fgetxattr
+finit_module flistxattr flock fork fremovexattr fsetxattr fstat fstatfs
+fsync ftruncate futex futimesat get_kernel_syms get_mempolicy
+get_robust_list getcpu getcwd getdents getdents64 getegid geteuid getgid
+getgroups getitimer getpeername getpgid getpgrp getpid getpmsg getppid
+getpriority getrandom getresgid getresuid getrlimit getrusage getsid
+getsockname getsockopt gettid gettimeofday getuid getxattr init_module
+inotify_add_watch inotify_init inotify_init1 inotify_rm_watch io_cancel
+io_destroy io_getevents io_pgetevents io_setup io_submit ioctl ioprio_get
+ioprio_set kcmp kexec_load keyctl kill lchown lgetxattr link linkat
+listen listxattr llistxattr lookup_dcookie lremovexattr lseek lsetxattr
+lstat madvise mbind membarrier memfd_create migrate_pages mincore mkdir
+mkdirat mknod mknodat mlock mlock2 mlockall mmap mount move_pages
+mprotect mq_getsetattr mq_notify mq_open mq_timedreceive mq_timedsend
+mq_unlink mremap msgctl msgget msgrcv msgsnd msync munlock munlockall
+munmap name_to_handle_at nanosleep newfstatat nfsservctl open
+open_by_handle_at openat pause perf_event_open personality pipe pipe2
+pivot_root pkey_alloc pkey_free pkey_mprotect poll ppoll prctl pread64
+preadv preadv2 prlimit64 process_vm_readv process_vm_writev pselect6
+ptrace putpmsg pwrite64 pwritev pwritev2 query_module quotactl read
+readahead readlink readlinkat readv reboot recvfrom recvmmsg recvmsg
+remap_file_pages removexattr rename renameat renameat2 request_key
+reserved177 reserved193 restart_syscall rmdir rseq rt_sigaction
+rt_sigpending rt_sigprocmask rt_sigqueueinfo rt_sigreturn rt_sigsuspend
+rt_sigtimedwait rt_tgsigqueueinfo sched_get_priority_max
+sched_get_priority_min sched_getaffinity sched_getattr sched_getparam
+sched_getscheduler sched_rr_get_interval sched_setaffinity sched_setattr
+sched_setparam sched_setscheduler sched_yield seccomp semctl semget semop
+semtimedop sendfile sendmmsg sendmsg sendto set_mempolicy set_robust_list
+set_thread_area set_tid_address setdomainname setfsgid setfsuid setgid
+setgroups sethostname setitimer setns setpgid setpriority setregid
+setresgid setresuid setreuid setrlimit setsid setsockopt settimeofday
+setuid setxattr shmat shmctl shmdt shmget shutdown sigaltstack signalfd
+signalfd4 socket socketpair splice stat statfs statx swapoff swapon
+symlink symlinkat sync sync_file_range syncfs sysfs sysinfo syslog
+sysmips tee tgkill timer_create timer_delete timer_getoverrun
+timer_gettime timer_settime timerfd timerfd_create timerfd_gettime
+timerfd_settime times tkill truncate umask umount2 uname unlink unlinkat
+unshare userfaultfd ustat utime utimensat utimes vhangup vmsplice vserver
+wait4 waitid write writev`,
+	"mips64le": `_newselect _sysctl accept accept4 access acct add_key adjtimex
+afs_syscall alarm bind bpf brk cachectl cacheflush capget capset chdir
+chmod chown chroot clock_adjtime clock_getres clock_gettime
+clock_nanosleep clock_settime clone close connect copy_file_range creat
+create_module delete_module dup dup2 dup3 epoll_create epoll_create1
+epoll_ctl epoll_pwait epoll_wait eventfd eventfd2 execve execveat exit
+exit_group faccessat fadvise64 fallocate fanotify_init fanotify_mark
+fchdir fchmod fchmodat fchown fchownat fcntl fdatasync fgetxattr
+finit_module flistxattr flock fork fremovexattr fsetxattr fstat fstatfs
+fsync ftruncate futex futimesat get_kernel_syms get_mempolicy
+get_robust_list getcpu getcwd getdents getdents64 getegid geteuid getgid
+getgroups getitimer getpeername getpgid getpgrp getpid getpmsg getppid
+getpriority getrandom getresgid getresuid getrlimit getrusage getsid
+getsockname getsockopt gettid gettimeofday getuid getxattr init_module
+inotify_add_watch inotify_init inotify_init1 inotify_rm_watch io_cancel
+io_destroy io_getevents io_pgetevents io_setup io_submit ioctl ioprio_get
+ioprio_set kcmp kexec_load keyctl kill lchown lgetxattr link linkat
+listen listxattr llistxattr lookup_dcookie lremovexattr lseek lsetxattr
+lstat madvise mbind membarrier memfd_create migrate_pages mincore mkdir
+mkdirat mknod mknodat mlock mlock2 mlockall mmap mount move_pages
+mprotect mq_getsetattr mq_notify mq_open mq_timedreceive mq_timedsend
+mq_unlink mremap msgctl msgget msgrcv msgsnd msync munlock munlockall
+munmap name_to_handle_at nanosleep newfstatat nfsservctl open
+open_by_handle_at openat pause perf_event_open personality pipe pipe2
+pivot_root pkey_alloc pkey_free pkey_mprotect poll ppoll prctl pread64
+preadv preadv2 prlimit64 process_vm_readv process_vm_writev pselect6
+ptrace putpmsg pwrite64 pwritev pwritev2 query_module quotactl read
+readahead readlink readlinkat readv reboot recvfrom recvmmsg recvmsg
+remap_file_pages removexattr rename renameat renameat2 request_key
+reserved177 reserved193 restart_syscall rmdir rseq rt_sigaction
+rt_sigpending rt_sigprocmask rt_sigqueueinfo rt_sigreturn rt_sigsuspend
+rt_sigtimedwait rt_tgsigqueueinfo sched_get_priority_max
+sched_get_priority_min sched_getaffinity sched_getattr sched_getparam
+sched_getscheduler sched_rr_get_interval sched_setaffinity sched_setattr
+sched_setparam sched_setscheduler sched_yield seccomp semctl semget semop
+semtimedop sendfile sendmmsg sendmsg sendto set_mempolicy set_robust_list
+set_thread_area set_tid_address setdomainname setfsgid setfsuid setgid
+setgroups sethostname setitimer setns setpgid setpriority setregid
+setresgid setresuid setreuid setrlimit setsid setsockopt settimeofday
+setuid setxattr shmat shmctl shmdt shmget shutdown sigaltstack signalfd
+signalfd4 socket socketpair splice stat statfs statx swapoff swapon
+symlink symlinkat sync sync_file_range syncfs sysfs sysinfo syslog
+sysmips tee tgkill timer_create timer_delete timer_getoverrun
+timer_gettime timer_settime timerfd timerfd_create timerfd_gettime
+timerfd_settime times tkill truncate umask umount2 uname unlink unlinkat
+unshare userfaultfd ustat utime utimensat utimes vhangup vmsplice vserver
+wait4 waitid write writev`,
+	"mipsle": `_llseek _newselect _sysctl accept accept4 access acct add_key adjtimex
+afs_syscall alarm bdflush bind bpf break brk cachectl cacheflush capget
+capset chdir chmod chown chroot clock_adjtime clock_getres clock_gettime
+clock_nanosleep clock_settime clone close connect copy_file_range creat
+create_module delete_module dup dup2 dup3 epoll_create epoll_create1
+epoll_ctl epoll_pwait epoll_wait eventfd eventfd2 execve execveat exit
+exit_group faccessat fadvise64 fallocate fanotify_init fanotify_mark
+fchdir fchmod fchmodat fchown fchownat fcntl fcntl64 fdatasync fgetxattr
+finit_module flistxattr flock fork fremovexattr fsetxattr fstat fstat64
+fstatat64 fstatfs fstatfs64 fsync ftime ftruncate ftruncate64 futex
+futimesat get_kernel_syms get_mempolicy get_robust_list getcpu getcwd
+getdents getdents64 getegid geteuid getgid getgroups getitimer
+getpeername getpgid getpgrp getpid getpmsg getppid getpriority getrandom
+getresgid getresuid getrlimit getrusage getsid getsockname getsockopt
+gettid gettimeofday getuid getxattr gtty idle init_module
+inotify_add_watch inotify_init inotify_init1 inotify_rm_watch io_cancel
+io_destroy io_getevents io_pgetevents io_setup io_submit ioctl ioperm
+iopl ioprio_get ioprio_set ipc kcmp kexec_load keyctl kill lchown
+lgetxattr link linkat listen listxattr llistxattr lock lookup_dcookie
+lremovexattr lseek lsetxattr lstat lstat64 madvise mbind membarrier
+memfd_create migrate_pages mincore mkdir mkdirat mknod mknodat mlock
+mlock2 mlockall mmap mmap2 modify_ldt mount move_pages mprotect mpx
+mq_getsetattr mq_notify mq_open mq_timedreceive mq_timedsend mq_unlink
+mremap msync munlock munlockall munmap name_to_handle_at nanosleep
+nfsservctl nice open open_by_handle_at openat pause perf_event_open
+personality pipe pipe2 pivot_root pkey_alloc pkey_free pkey_mprotect poll
+ppoll prctl pread64 preadv preadv2 prlimit64 process_vm_readv
+process_vm_writev prof profil pselect6 ptrace putpmsg pwrite64 pwritev
+pwritev2 query_module quotactl read readahead readdir readlink readlinkat
+readv reboot recv recvfrom recvmmsg recvmsg remap_file_pages removexattr
+rename renameat renameat2 request_key reserved221 reserved82
+restart_syscall rmdir rseq rt_sigaction rt_sigpending rt_sigprocmask
+rt_sigqueueinfo rt_sigreturn rt_sigsuspend rt_sigtimedwait
+rt_tgsigqueueinfo sched_get_priority_max sched_get_priority_min
+sched_getaffinity sched_getattr sched_getparam sched_getscheduler
+sched_rr_get_interval sched_setaffinity sched_setattr sched_setparam
+sched_setscheduler sched_yield seccomp send sendfile sendfile64 sendmmsg
+sendmsg sendto set_mempolicy set_robust_list set_thread_area
+set_tid_address setdomainname setfsgid setfsuid setgid setgroups
+sethostname setitimer setns setpgid setpriority setregid setresgid
+setresuid setreuid setrlimit setsid setsockopt settimeofday setuid
+setxattr sgetmask shutdown sigaction sigaltstack signal signalfd
+signalfd4 sigpending sigprocmask sigreturn sigsuspend socket socketcall
+socketpair splice ssetmask stat stat64 statfs statfs64 statx stime stty
+swapoff swapon symlink symlinkat sync sync_file_range syncfs syscall
+sysfs sysinfo syslog sysmips tee tgkill time timer_create timer_delete
+timer_getoverrun timer_gettime timer_settime timerfd timerfd_create
+timerfd_gettime timerfd_settime times tkill truncate truncate64 ulimit
+umask umount umount2 uname unlink unlinkat unshare unused109 unused150
+unused18 unused28 unused59 unused84 uselib userfaultfd ustat utime
+utimensat utimes vhangup vm86 vmsplice vserver wait4 waitid waitpid write
+writev`,
+	"ppc64": `_llseek _newselect _sysctl accept accept4 access acct add_key adjtimex
+afs_syscall alarm bdflush bind bpf break brk capget capset chdir chmod
+chown chroot clock_adjtime clock_getres clock_gettime clock_nanosleep
+clock_settime clone close connect copy_file_range creat create_module
+delete_module dup dup2 dup3 epoll_create epoll_create1 epoll_ctl
+epoll_pwait epoll_wait eventfd eventfd2 execve execveat exit exit_group
+faccessat fadvise64 fallocate fanotify_init fanotify_mark fchdir fchmod
+fchmodat fchown fchownat fcntl fdatasync fgetxattr finit_module
+flistxattr flock fork fremovexattr fsetxattr fstat fstatfs fstatfs64
+fsync ftime ftruncate futex futimesat get_kernel_syms get_mempolicy
+get_robust_list getcpu getcwd getdents getdents64 getegid geteuid getgid
+getgroups getitimer getpeername getpgid getpgrp getpid getpmsg getppid
+getpriority getrandom getresgid getresuid getrlimit getrusage getsid
+getsockname getsockopt gettid gettimeofday getuid getxattr gtty idle
+init_module inotify_add_watch inotify_init inotify_init1 inotify_rm_watch
+io_cancel io_destroy io_getevents io_pgetevents io_setup io_submit ioctl
+ioperm iopl ioprio_get ioprio_set ipc kcmp kexec_file_load kexec_load
+keyctl kill lchown lgetxattr link linkat listen listxattr llistxattr lock
+lookup_dcookie lremovexattr lseek lsetxattr lstat madvise mbind
+membarrier memfd_create migrate_pages mincore mkdir mkdirat mknod mknodat
+mlock mlock2 mlockall mmap modify_ldt mount move_pages mprotect mpx
+mq_getsetattr mq_notify mq_open mq_timedreceive mq_timedsend mq_unlink
+mremap msync multiplexer munlock munlockall munmap name_to_handle_at
+nanosleep newfstatat nfsservctl nice oldfstat oldlstat oldolduname
+oldstat olduname open open_by_handle_at openat pause pciconfig_iobase
+pciconfig_read pciconfig_write perf_event_open personality pipe pipe2
+pivot_root pkey_alloc pkey_free pkey_mprotect poll ppoll prctl pread64
+preadv preadv2 prlimit64 process_vm_readv process_vm_writev prof profil
+pselect6 ptrace putpmsg pwrite64 pwritev pwritev2 query_module quotactl
+read readahead readdir readlink readlinkat readv reboot recv recvfrom
+recvmmsg recvmsg remap_file_pages removexattr rename renameat renameat2
+request_key restart_syscall rmdir rseq rt_sigaction rt_sigpending
+rt_sigprocmask rt_sigqueueinfo rt_sigreturn rt_sigsuspend rt_sigtimedwait
+rt_tgsigqueueinfo rtas sched_get_priority_max sched_get_priority_min
+sched_getaffinity sched_getattr sched_getparam sched_getscheduler
+sched_rr_get_interval sched_setaffinity sched_setattr sched_setparam
+sched_setscheduler sched_yield seccomp select send sendfile sendmmsg
+sendmsg sendto set_mempolicy set_robust_list set_tid_address
+setdomainname setfsgid setfsuid setgid setgroups sethostname setitimer
+setns setpgid setpriority setregid setresgid setresuid setreuid setrlimit
+setsid setsockopt settimeofday setuid setxattr sgetmask shutdown
+sigaction sigaltstack signal signalfd signalfd4 sigpending sigprocmask
+sigreturn sigsuspend socket socketcall socketpair splice spu_create
+spu_run ssetmask stat statfs statfs64 statx stime stty subpage_prot
+swapcontext swapoff swapon switch_endian symlink symlinkat sync
+sync_file_range2 syncfs sys_debug_setcontext sysfs sysinfo syslog tee
+tgkill time timer_create timer_delete timer_getoverrun timer_gettime
+timer_settime timerfd_create timerfd_gettime timerfd_settime times tkill
+truncate tuxcall ugetrlimit ulimit umask umount umount2 uname unlink
+unlinkat unshare uselib userfaultfd ustat utime utimensat utimes vfork
+vhangup vm86 vmsplice wait4 waitid waitpid write writev`,
+	"ppc64le": `_llseek _newselect _sysctl accept accept4 access acct add_key adjtimex
+afs_syscall alarm bdflush bind bpf break brk capget capset chdir chmod
+chown chroot clock_adjtime clock_getres clock_gettime clock_nanosleep
+clock_settime clone close connect copy_file_range creat create_module
+delete_module dup dup2 dup3 epoll_create epoll_create1 epoll_ctl
+epoll_pwait epoll_wait eventfd eventfd2 execve execveat exit exit_group
+faccessat fadvise64 fallocate fanotify_init fanotify_mark fchdir fchmod
+fchmodat fchown fchownat fcntl fdatasync fgetxattr finit_module
+flistxattr flock fork fremovexattr fsetxattr fstat fstatfs fstatfs64
+fsync ftime ftruncate futex futimesat get_kernel_syms get_mempolicy
+get_robust_list getcpu getcwd getdents getdents64 getegid geteuid getgid
+getgroups getitimer getpeername getpgid getpgrp getpid getpmsg getppid
+getpriority getrandom getresgid getresuid getrlimit getrusage getsid
+getsockname getsockopt gettid gettimeofday getuid getxattr gtty idle
+init_module inotify_add_watch inotify_init inotify_init1 inotify_rm_watch
+io_cancel io_destroy io_getevents io_pgetevents io_setup io_submit ioctl
+ioperm iopl ioprio_get ioprio_set ipc kcmp kexec_file_load kexec_load
+keyctl kill lchown lgetxattr link linkat listen listxattr llistxattr lock
+lookup_dcookie lremovexattr lseek lsetxattr lstat madvise mbind
+membarrier memfd_create migrate_pages mincore mkdir mkdirat mknod mknodat
+mlock mlock2 mlockall mmap modify_ldt mount move_pages mprotect mpx
+mq_getsetattr mq_notify mq_open mq_timedreceive mq_timedsend mq_unlink
+mremap msync multiplexer munlock munlockall munmap name_to_handle_at
+nanosleep newfstatat nfsservctl nice oldfstat oldlstat oldolduname
+oldstat olduname open open_by_handle_at openat pause pciconfig_iobase
+pciconfig_read pciconfig_write perf_event_open personality pipe pipe2
+pivot_root pkey_alloc pkey_free pkey_mprotect poll ppoll prctl pread64
+preadv preadv2 prlimit64 process_vm_readv process_vm_writev prof profil
+pselect6 ptrace putpmsg pwrite64 pwritev pwritev2 query_module quotactl
+read readahead readdir readlink readlinkat readv reboot recv recvfrom
+recvmmsg recvmsg remap_file_pages removexattr rename renameat renameat2
+request_key restart_syscall rmdir rseq rt_sigaction rt_sigpending
+rt_sigprocmask rt_sigqueueinfo rt_sigreturn rt_sigsuspend rt_sigtimedwait
+rt_tgsigqueueinfo rtas sched_get_priority_max sched_get_priority_min
+sched_getaffinity sched_getattr sched_getparam sched_getscheduler
+sched_rr_get_interval sched_setaffinity sched_setattr sched_setparam
+sched_setscheduler sched_yield seccomp select send sendfile sendmmsg
+sendmsg sendto set_mempolicy set_robust_list set_tid_address
+setdomainname setfsgid setfsuid setgid setgroups sethostname setitimer
+setns setpgid setpriority setregid setresgid setresuid setreuid setrlimit
+setsid setsockopt settimeofday setuid setxattr sgetmask shutdown
+sigaction sigaltstack signal signalfd signalfd4 sigpending sigprocmask
+sigreturn sigsuspend socket socketcall socketpair splice spu_create
+spu_run ssetmask stat statfs statfs64 statx stime stty subpage_prot
+swapcontext swapoff swapon switch_endian symlink symlinkat sync
+sync_file_range2 syncfs sys_debug_setcontext sysfs sysinfo syslog tee
+tgkill time timer_create timer_delete timer_getoverrun timer_gettime
+timer_settime timerfd_create timerfd_gettime timerfd_settime times tkill
+truncate tuxcall ugetrlimit ulimit umask umount umount2 uname unlink
+unlinkat unshare uselib userfaultfd ustat utime utimensat utimes vfork
+vhangup vm86 vmsplice wait4 waitid waitpid write writev`,
+	"riscv64": `accept accept4 acct add_key adjtimex arch_specific_syscall bind bpf brk
+capget capset chdir chroot clock_adjtime clock_getres clock_gettime
+clock_nanosleep clock_settime clone close connect copy_file_range
+delete_module dup dup3 epoll_create1 epoll_ctl epoll_pwait eventfd2
+execve execveat exit exit_group faccessat fadvise64 fallocate
+fanotify_init fanotify_mark fchdir fchmod fchmodat fchown fchownat fcntl
+fdatasync fgetxattr finit_module flistxattr flock fremovexattr fsetxattr
+fstat fstatat fstatfs fsync ftruncate futex get_mempolicy get_robust_list
+getcpu getcwd getdents64 getegid geteuid getgid getgroups getitimer
+getpeername getpgid getpid getppid getpriority getrandom getresgid
+getresuid getrlimit getrusage getsid getsockname getsockopt gettid
+gettimeofday getuid getxattr init_module inotify_add_watch inotify_init1
+inotify_rm_watch io_cancel io_destroy io_getevents io_pgetevents io_setup
+io_submit ioctl ioprio_get ioprio_set kcmp kexec_load keyctl kill
+lgetxattr linkat listen listxattr llistxattr lookup_dcookie lremovexattr
+lseek lsetxattr madvise mbind membarrier memfd_create migrate_pages
+mincore mkdirat mknodat mlock mlock2 mlockall mmap mount move_pages
+mprotect mq_getsetattr mq_notify mq_open mq_timedreceive mq_timedsend
+mq_unlink mremap msgctl msgget msgrcv msgsnd msync munlock munlockall
+munmap name_to_handle_at nanosleep nfsservctl open_by_handle_at openat
+perf_event_open personality pipe2 pivot_root pkey_alloc pkey_free
+pkey_mprotect ppoll prctl pread64 preadv preadv2 prlimit64
+process_vm_readv process_vm_writev pselect6 ptrace pwrite64 pwritev
+pwritev2 quotactl read readahead readlinkat readv reboot recvfrom
+recvmmsg recvmsg remap_file_pages removexattr renameat2 request_key
+restart_syscall rt_sigaction rt_sigpending rt_sigprocmask rt_sigqueueinfo
+rt_sigreturn rt_sigsuspend rt_sigtimedwait rt_tgsigqueueinfo
+sched_get_priority_max sched_get_priority_min sched_getaffinity
+sched_getattr sched_getparam sched_getscheduler sched_rr_get_interval
+sched_setaffinity sched_setattr sched_setparam sched_setscheduler
+sched_yield seccomp semctl semget semop semtimedop sendfile sendmmsg
+sendmsg sendto set_mempolicy set_robust_list set_tid_address
+setdomainname setfsgid setfsuid setgid setgroups sethostname setitimer
+setns setpgid setpriority setregid setresgid setresuid setreuid setrlimit
+setsid setsockopt settimeofday setuid setxattr shmat shmctl shmdt shmget
+shutdown sigaltstack signalfd4 socket socketpair splice statfs statx
+swapoff swapon symlinkat sync sync_file_range syncfs sysinfo syslog tee
+tgkill timer_create timer_delete timer_getoverrun timer_gettime
+timer_settime timerfd_create timerfd_gettime timerfd_settime times tkill
+truncate umask umount2 uname unlinkat unshare userfaultfd utimensat
+vhangup vmsplice wait4 waitid write writev`,
+	"s390x": `_sysctl accept4 access acct add_key adjtimex afs_syscall alarm bdflush
+bind bpf brk capget capset chdir chmod chown chroot clock_adjtime
+clock_getres clock_gettime clock_nanosleep clock_settime clone close
+connect copy_file_range creat create_module delete_module dup dup2 dup3
+epoll_create epoll_create1 epoll_ctl epoll_pwait epoll_wait eventfd
+eventfd2 execve execveat exit exit_group faccessat fadvise64 fallocate
+fanotify_init fanotify_mark fchdir fchmod fchmodat fchown fchownat fcntl
+fdatasync fgetxattr finit_module flistxattr flock fork fremovexattr
+fsetxattr fstat fstatfs fstatfs64 fsync ftruncate futex futimesat
+get_kernel_syms get_mempolicy get_robust_list getcpu getcwd getdents
+getdents64 getegid geteuid getgid getgroups getitimer getpeername getpgid
+getpgrp getpid getpmsg getppid getpriority getrandom getresgid getresuid
+getrlimit getrusage getsid getsockname getsockopt gettid gettimeofday
+getuid getxattr idle init_module inotify_add_watch inotify_init
+inotify_init1 inotify_rm_watch io_cancel io_destroy io_getevents
+io_pgetevents io_setup io_submit ioctl ioprio_get ioprio_set ipc kcmp
+kexec_file_load kexec_load keyctl kill lchown lgetxattr link linkat
+listen listxattr llistxattr lookup_dcookie lremovexattr lseek lsetxattr
+lstat madvise mbind membarrier memfd_create migrate_pages mincore mkdir
+mkdirat mknod mknodat mlock mlock2 mlockall mmap mount move_pages
+mprotect mq_getsetattr mq_notify mq_open mq_timedreceive mq_timedsend
+mq_unlink mremap msync munlock munlockall munmap name_to_handle_at
+nanosleep newfstatat nfsservctl nice open open_by_handle_at openat pause
+perf_event_open personality pipe pipe2 pivot_root poll ppoll prctl
+pread64 preadv preadv2 prlimit64 process_vm_readv process_vm_writev
+pselect6 ptrace putpmsg pwrite64 pwritev pwritev2 query_module quotactl
+read readahead readdir readlink readlinkat readv reboot recvfrom recvmmsg
+recvmsg remap_file_pages removexattr rename renameat renameat2
+request_key restart_syscall rmdir rseq rt_sigaction rt_sigpending
+rt_sigprocmask rt_sigqueueinfo rt_sigreturn rt_sigsuspend rt_sigtimedwait
+rt_tgsigqueueinfo s390_guarded_storage s390_pci_mmio_read
+s390_pci_mmio_write s390_runtime_instr s390_sthyi sched_get_priority_max
+sched_get_priority_min sched_getaffinity sched_getattr sched_getparam
+sched_getscheduler sched_rr_get_interval sched_setaffinity sched_setattr
+sched_setparam sched_setscheduler sched_yield seccomp select sendfile
+sendmmsg sendmsg sendto set_mempolicy set_robust_list set_tid_address
+setdomainname setfsgid setfsuid setgid setgroups sethostname setitimer
+setns setpgid setpriority setregid setresgid setresuid setreuid setrlimit
+setsid setsockopt settimeofday setuid setxattr shutdown sigaction
+sigaltstack signal signalfd signalfd4 sigpending sigprocmask sigreturn
+sigsuspend socket socketcall socketpair splice stat statfs statfs64 statx
+swapoff swapon symlink symlinkat sync sync_file_range syncfs sysfs
+sysinfo syslog tee tgkill timer_create timer_delete timer_getoverrun
+timer_gettime timer_settime timerfd timerfd_create timerfd_gettime
+timerfd_settime times tkill truncate umask umount umount2 uname unlink
+unlinkat unshare uselib userfaultfd ustat utime utimensat utimes vfork
+vhangup vmsplice wait4 waitid write writev`,
+	"sparc64": `_llseek _newselect _sysctl accept accept4 access acct add_key adjtimex
+afs_syscall alarm bdflush bind bpf brk capget capset chdir chmod chown
+chroot clock_adjtime clock_getres clock_gettime clock_nanosleep
+clock_settime clone close connect copy_file_range creat create_module
+delete_module dup dup2 dup3 epoll_create epoll_create1 epoll_ctl
+epoll_pwait epoll_wait eventfd eventfd2 execv execve execveat exit
+exit_group faccessat fadvise64 fadvise64_64 fallocate fanotify_init
+fanotify_mark fchdir fchmod fchmodat fchown fchownat fcntl fdatasync
+fgetxattr finit_module flistxattr flock fork fremovexattr fsetxattr fstat
+fstat64 fstatat64 fstatfs fstatfs64 fsync ftruncate futex futimesat
+get_kernel_syms get_mempolicy get_robust_list getcpu getcwd getdents
+getdents64 getdomainname getegid geteuid getgid getgroups getitimer
+getpagesize getpeername getpgid getpgrp getpid getppid getpriority
+getrandom getresgid getresuid getrlimit getrusage getsid getsockname
+getsockopt gettid gettimeofday getuid getxattr init_module
+inotify_add_watch inotify_init inotify_init1 inotify_rm_watch io_cancel
+io_destroy io_getevents io_setup io_submit ioctl ioprio_get ioprio_set
+ipc kcmp kern_features kexec_load keyctl kill lchown lgetxattr link
+linkat listen listxattr llistxattr lookup_dcookie lremovexattr lseek
+lsetxattr lstat lstat64 madvise mbind membarrier memfd_create
+memory_ordering migrate_pages mincore mkdir mkdirat mknod mknodat mlock
+mlock2 mlockall mmap mount move_pages mprotect mq_getsetattr mq_notify
+mq_open mq_timedreceive mq_timedsend mq_unlink mremap msync munlock
+munlockall munmap name_to_handle_at nanosleep nfsservctl nice oldlstat
+open open_by_handle_at openat pause pciconfig_read pciconfig_write
+perf_event_open perfctr personality pipe pipe2 pivot_root poll ppoll
+prctl pread64 preadv preadv2 prlimit64 process_vm_readv process_vm_writev
+pselect6 ptrace pwrite64 pwritev pwritev2 query_module quotactl read
+readahead readdir readlink readlinkat readv reboot recvfrom recvmmsg
+recvmsg remap_file_pages removexattr rename renameat renameat2
+request_key restart_syscall rmdir rt_sigaction rt_sigpending
+rt_sigprocmask rt_sigqueueinfo rt_sigreturn rt_sigsuspend rt_sigtimedwait
+rt_tgsigqueueinfo sched_get_affinity sched_get_priority_max
+sched_get_priority_min sched_getaffinity sched_getattr sched_getparam
+sched_getscheduler sched_rr_get_interval sched_set_affinity
+sched_setaffinity sched_setattr sched_setparam sched_setscheduler
+sched_yield seccomp select sendfile sendfile64 sendmmsg sendmsg sendto
+set_mempolicy set_robust_list set_tid_address setdomainname setfsgid
+setfsuid setgid setgroups sethostname setitimer setns setpgid setpriority
+setregid setresgid setresuid setreuid setrlimit setsid setsockopt
+settimeofday setuid setxattr sgetmask shutdown sigaction sigaltstack
+signal signalfd signalfd4 sigpending sigprocmask sigreturn sigsuspend
+socket socketcall socketpair splice ssetmask stat stat64 statfs statfs64
+stime swapoff swapon symlink symlinkat sync sync_file_range syncfs sysfs
+sysinfo syslog tee tgkill timer_create timer_delete timer_getoverrun
+timer_gettime timer_settime timerfd_create timerfd_gettime
+timerfd_settime times tkill truncate umask umount umount2 uname unlink
+unlinkat unshare uselib userfaultfd ustat utime utimensat utimes
+utrap_install vfork vhangup vmsplice wait4 waitid waitpid write writev`,
+}
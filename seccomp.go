@@ -1,6 +1,335 @@
 package main
 
-var seccompConfigs = map[dockerProfile]string{
-	defaultDockerProfile: defaultSeccompConfig,
-	weakDockerProfile:    weakSeccompConfig,
+//go:generate go run mksyscalls.go
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// seccompConfigs holds the builtin seccomp profiles, profiles and overlays
+// can refer to them by name.
+var seccompConfigs = map[string]string{
+	"default": defaultSeccompConfig,
+}
+
+// seccompProfile is a seccomp profile in the format understood by the docker
+// daemon.
+type seccompProfile struct {
+	DefaultAction string `json:"defaultAction"`
+	// DefaultErrnoRet is the errno returned by the default action, EPERM
+	// when unset.
+	DefaultErrnoRet *uint            `json:"defaultErrnoRet,omitempty"`
+	ArchMap         []seccompArchMap `json:"archMap,omitempty"`
+	Syscalls        []seccompSyscall `json:"syscalls"`
+}
+
+// seccompArchMap maps an architecture to its sub-architectures.
+type seccompArchMap struct {
+	Architecture     string   `json:"architecture"`
+	SubArchitectures []string `json:"subArchitectures"`
+}
+
+// seccompSyscall is a rule applying action to a set of syscalls.
+type seccompSyscall struct {
+	Name     string        `json:"name,omitempty"`
+	Names    []string      `json:"names,omitempty"`
+	Action   string        `json:"action"`
+	ErrnoRet *uint         `json:"errnoRet,omitempty"`
+	Args     []seccompArg  `json:"args"`
+	Comment  string        `json:"comment"`
+	Includes seccompFilter `json:"includes"`
+	Excludes seccompFilter `json:"excludes"`
+}
+
+// seccompArg is a condition on a syscall argument.
+type seccompArg struct {
+	Index    uint   `json:"index"`
+	Value    uint64 `json:"value"`
+	ValueTwo uint64 `json:"valueTwo"`
+	Op       string `json:"op"`
+}
+
+// seccompFilter restricts a rule to containers with the given capabilities,
+// architectures or kernel version.
+type seccompFilter struct {
+	Caps      []string `json:"caps,omitempty"`
+	Arches    []string `json:"arches,omitempty"`
+	MinKernel string   `json:"minKernel,omitempty"`
+}
+
+var seccompActions = map[string]struct{}{
+	"SCMP_ACT_KILL":         {},
+	"SCMP_ACT_KILL_PROCESS": {},
+	"SCMP_ACT_KILL_THREAD":  {},
+	"SCMP_ACT_TRAP":         {},
+	"SCMP_ACT_ERRNO":        {},
+	"SCMP_ACT_TRACE":        {},
+	"SCMP_ACT_ALLOW":        {},
+	"SCMP_ACT_LOG":          {},
+}
+
+var seccompOperators = map[string]struct{}{
+	"SCMP_CMP_NE":        {},
+	"SCMP_CMP_LT":        {},
+	"SCMP_CMP_LE":        {},
+	"SCMP_CMP_EQ":        {},
+	"SCMP_CMP_GE":        {},
+	"SCMP_CMP_GT":        {},
+	"SCMP_CMP_MASKED_EQ": {},
+}
+
+// seccompArches maps the seccomp architectures to the syscall table in
+// syscallNames they use.
+var seccompArches = map[string]string{
+	"SCMP_ARCH_X86":         "386",
+	"SCMP_ARCH_X86_64":      "amd64",
+	"SCMP_ARCH_X32":         "amd64",
+	"SCMP_ARCH_ARM":         "arm",
+	"SCMP_ARCH_AARCH64":     "arm64",
+	"SCMP_ARCH_MIPS":        "mips",
+	"SCMP_ARCH_MIPS64":      "mips64",
+	"SCMP_ARCH_MIPS64N32":   "mips64",
+	"SCMP_ARCH_MIPSEL":      "mipsle",
+	"SCMP_ARCH_MIPSEL64":    "mips64le",
+	"SCMP_ARCH_MIPSEL64N32": "mips64le",
+	"SCMP_ARCH_PPC":         "ppc64",
+	"SCMP_ARCH_PPC64":       "ppc64",
+	"SCMP_ARCH_PPC64LE":     "ppc64le",
+	"SCMP_ARCH_S390":        "s390x",
+	"SCMP_ARCH_S390X":       "s390x",
+}
+
+// ruleArches maps the architecture names used in includes and excludes to
+// the syscall table in syscallNames they use.
+var ruleArches = map[string]string{
+	"386":      "386",
+	"x86":      "386",
+	"amd64":    "amd64",
+	"x32":      "amd64",
+	"arm":      "arm",
+	"arm64":    "arm64",
+	"mips":     "mips",
+	"mipsle":   "mipsle",
+	"mips64":   "mips64",
+	"mips64le": "mips64le",
+	"ppc":      "ppc64",
+	"ppc64":    "ppc64",
+	"ppc64le":  "ppc64le",
+	"s390":     "s390x",
+	"s390x":    "s390x",
+}
+
+// syscallTables holds the parsed syscallNames.
+var syscallTables = func() map[string]map[string]struct{} {
+	tables := make(map[string]map[string]struct{}, len(syscallNames))
+	for arch, names := range syscallNames {
+		tables[arch] = map[string]struct{}{}
+		for _, name := range strings.Fields(names) {
+			tables[arch][name] = struct{}{}
+		}
+	}
+	return tables
+}()
+
+var minKernelRe = regexp.MustCompile(`^[0-9]+\.[0-9]+$`)
+
+// parseSeccomp parses and validates a seccomp profile.
+func parseSeccomp(r io.Reader) (*seccompProfile, error) {
+	var s seccompProfile
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&s); err != nil {
+		return nil, err
+	}
+	if err := s.validate(); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// loadSeccomp returns the seccomp profile ref refers to. ref is either the
+// name of a builtin seccomp profile or the path to a JSON file, relative to
+// dir. The file holds either a full seccomp profile or a seccompOverlay.
+func loadSeccomp(ref, dir string) (*seccompProfile, error) {
+	return resolveSeccomp(ref, dir, nil)
+}
+
+// resolveSeccomp implements loadSeccomp, seen holds the files of the
+// overlays being resolved to detect cycles.
+func resolveSeccomp(ref, dir string, seen []string) (*seccompProfile, error) {
+	if config, ok := seccompConfigs[ref]; ok {
+		s, err := parseSeccomp(strings.NewReader(config))
+		if err != nil {
+			return nil, fmt.Errorf("builtin seccomp profile %q: %v", ref, err)
+		}
+		return s, nil
+	}
+
+	if filepath.Ext(ref) != ".json" {
+		return nil, fmt.Errorf("seccomp profile %q is neither builtin nor a .json file", ref)
+	}
+	if !filepath.IsAbs(ref) {
+		ref = filepath.Join(dir, ref)
+	}
+	for _, file := range seen {
+		if file == ref {
+			return nil, fmt.Errorf("seccomp profile %s is its own base", ref)
+		}
+	}
+	b, err := ioutil.ReadFile(ref)
+	if err != nil {
+		return nil, fmt.Errorf("reading seccomp profile: %v", err)
+	}
+
+	var s *seccompProfile
+	if isSeccompOverlay(b) {
+		s, err = resolveSeccompOverlay(bytes.NewReader(b), filepath.Dir(ref), append(seen, ref))
+	} else {
+		s, err = parseSeccomp(bytes.NewReader(b))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("seccomp profile %s: %v", ref, err)
+	}
+	return s, nil
+}
+
+// validate checks the actions, architectures, argument operators and
+// syscall names of a seccomp profile.
+func (s *seccompProfile) validate() error {
+	if _, ok := seccompActions[s.DefaultAction]; !ok {
+		return fmt.Errorf("defaultAction: unknown action %q", s.DefaultAction)
+	}
+	if s.DefaultErrnoRet != nil && s.DefaultAction != "SCMP_ACT_ERRNO" {
+		return fmt.Errorf("defaultErrnoRet: only valid with defaultAction SCMP_ACT_ERRNO, given: %s", s.DefaultAction)
+	}
+
+	// tables holds the syscall tables of every architecture the profile
+	// applies to.
+	tables := map[string]struct{}{}
+	for i, a := range s.ArchMap {
+		for _, arch := range append([]string{a.Architecture}, a.SubArchitectures...) {
+			table, ok := seccompArches[arch]
+			if !ok {
+				return fmt.Errorf("archMap[%d]: unknown architecture %q", i, arch)
+			}
+			tables[table] = struct{}{}
+		}
+	}
+	if len(s.ArchMap) == 0 {
+		for table := range syscallTables {
+			tables[table] = struct{}{}
+		}
+	}
+
+	for i, sc := range s.Syscalls {
+		if err := sc.validate(tables); err != nil {
+			return fmt.Errorf("syscalls[%d]: %v", i, err)
+		}
+	}
+
+	return nil
+}
+
+// validate checks a single syscall rule, tables holds the syscall tables of
+// the architectures of the profile.
+func (sc *seccompSyscall) validate(tables map[string]struct{}) error {
+	if sc.Name != "" && len(sc.Names) > 0 {
+		return fmt.Errorf("only one of name and names can be set")
+	}
+	if sc.Name == "" && len(sc.Names) == 0 {
+		return fmt.Errorf("one of name or names is required")
+	}
+
+	if _, ok := seccompActions[sc.Action]; !ok {
+		return fmt.Errorf("unknown action %q", sc.Action)
+	}
+	if sc.ErrnoRet != nil && sc.Action != "SCMP_ACT_ERRNO" {
+		return fmt.Errorf("errnoRet: only valid with action SCMP_ACT_ERRNO, given: %s", sc.Action)
+	}
+
+	for j, arg := range sc.Args {
+		if arg.Index > 5 {
+			return fmt.Errorf("args[%d]: index must be between 0 and 5, given: %d", j, arg.Index)
+		}
+		if _, ok := seccompOperators[arg.Op]; !ok {
+			return fmt.Errorf("args[%d]: unknown operator %q", j, arg.Op)
+		}
+	}
+
+	for _, f := range []struct {
+		field  string
+		filter seccompFilter
+	}{
+		{"includes", sc.Includes},
+		{"excludes", sc.Excludes},
+	} {
+		for _, c := range f.filter.Caps {
+			if _, ok := capabilities[strings.TrimPrefix(c, "CAP_")]; !ok || !strings.HasPrefix(c, "CAP_") {
+				return fmt.Errorf("%s: unknown capability %q", f.field, c)
+			}
+		}
+		for _, arch := range f.filter.Arches {
+			if _, ok := ruleArches[arch]; !ok {
+				return fmt.Errorf("%s: unknown architecture %q", f.field, arch)
+			}
+		}
+		if f.filter.MinKernel != "" && !minKernelRe.MatchString(f.filter.MinKernel) {
+			return fmt.Errorf("%s: invalid minKernel %q, expected <major>.<minor>", f.field, f.filter.MinKernel)
+		}
+	}
+
+	// A rule limited to some architectures only needs to name syscalls of
+	// those architectures.
+	if len(sc.Includes.Arches) > 0 {
+		tables = map[string]struct{}{}
+		for _, arch := range sc.Includes.Arches {
+			tables[ruleArches[arch]] = struct{}{}
+		}
+	}
+	names := sc.Names
+	if sc.Name != "" {
+		names = []string{sc.Name}
+	}
+	seen := map[string]struct{}{}
+	for j, name := range names {
+		if name == "" {
+			return fmt.Errorf("names[%d]: empty syscall name", j)
+		}
+		if _, ok := seen[name]; ok {
+			return fmt.Errorf("names[%d]: syscall %q is named twice", j, name)
+		}
+		seen[name] = struct{}{}
+		if !syscallExists(name, tables) {
+			return fmt.Errorf("unknown syscall %q for architectures %s", name, strings.Join(sortedKeys(tables), ", "))
+		}
+	}
+
+	return nil
+}
+
+// syscallExists returns whether name is a syscall in any of tables.
+func syscallExists(name string, tables map[string]struct{}) bool {
+	for table := range tables {
+		if _, ok := syscallTables[table][name]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys(m map[string]struct{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
 }
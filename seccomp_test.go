@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseSeccomp(t *testing.T) {
+	for _, tc := range []struct {
+		name, profile, err string
+	}{
+		{
+			name:    "valid",
+			profile: `{"defaultAction": "SCMP_ACT_ERRNO", "archMap": [{"architecture": "SCMP_ARCH_X86_64", "subArchitectures": ["SCMP_ARCH_X86"]}], "syscalls": [{"names": ["read", "write"], "action": "SCMP_ACT_ALLOW", "args": []}]}`,
+		},
+		{
+			name:    "errno",
+			profile: `{"defaultAction": "SCMP_ACT_ERRNO", "defaultErrnoRet": 1, "syscalls": [{"name": "bpf", "action": "SCMP_ACT_ERRNO", "errnoRet": 38, "args": []}]}`,
+		},
+		{
+			name:    "unknown default action",
+			profile: `{"defaultAction": "SCMP_ACT_NOPE", "syscalls": []}`,
+			err:     `defaultAction: unknown action "SCMP_ACT_NOPE"`,
+		},
+		{
+			name:    "unknown action",
+			profile: `{"defaultAction": "SCMP_ACT_ERRNO", "syscalls": [{"name": "read", "action": "SCMP_ACT_NOPE"}]}`,
+			err:     `syscalls[0]: unknown action "SCMP_ACT_NOPE"`,
+		},
+		{
+			name:    "unknown architecture",
+			profile: `{"defaultAction": "SCMP_ACT_ERRNO", "archMap": [{"architecture": "SCMP_ARCH_X86_64", "subArchitectures": ["SCMP_ARCH_VAX"]}], "syscalls": []}`,
+			err:     `archMap[0]: unknown architecture "SCMP_ARCH_VAX"`,
+		},
+		{
+			name:    "unknown rule architecture",
+			profile: `{"defaultAction": "SCMP_ACT_ERRNO", "syscalls": [{"name": "read", "action": "SCMP_ACT_ALLOW", "includes": {"arches": ["vax"]}}]}`,
+			err:     `syscalls[0]: includes: unknown architecture "vax"`,
+		},
+		{
+			name:    "bad operator",
+			profile: `{"defaultAction": "SCMP_ACT_ERRNO", "syscalls": [{"name": "personality", "action": "SCMP_ACT_ALLOW", "args": [{"index": 0, "value": 8, "op": "SCMP_CMP_LIKE"}]}]}`,
+			err:     `syscalls[0]: args[0]: unknown operator "SCMP_CMP_LIKE"`,
+		},
+		{
+			name:    "bad argument index",
+			profile: `{"defaultAction": "SCMP_ACT_ERRNO", "syscalls": [{"name": "personality", "action": "SCMP_ACT_ALLOW", "args": [{"index": 6, "value": 8, "op": "SCMP_CMP_EQ"}]}]}`,
+			err:     `syscalls[0]: args[0]: index must be between 0 and 5, given: 6`,
+		},
+		{
+			name:    "duplicate name",
+			profile: `{"defaultAction": "SCMP_ACT_ERRNO", "syscalls": [{"names": ["read", "write", "read"], "action": "SCMP_ACT_ALLOW"}]}`,
+			err:     `syscalls[0]: names[2]: syscall "read" is named twice`,
+		},
+		{
+			name:    "empty name",
+			profile: `{"defaultAction": "SCMP_ACT_ERRNO", "syscalls": [{"names": [""], "action": "SCMP_ACT_ALLOW"}]}`,
+			err:     `syscalls[0]: names[0]: empty syscall name`,
+		},
+		{
+			name:    "name and names",
+			profile: `{"defaultAction": "SCMP_ACT_ERRNO", "syscalls": [{"name": "read", "names": ["write"], "action": "SCMP_ACT_ALLOW"}]}`,
+			err:     `syscalls[0]: only one of name and names can be set`,
+		},
+		{
+			name:    "no name",
+			profile: `{"defaultAction": "SCMP_ACT_ERRNO", "syscalls": [{"action": "SCMP_ACT_ALLOW"}]}`,
+			err:     `syscalls[0]: one of name or names is required`,
+		},
+		{
+			name:    "unknown syscall",
+			profile: `{"defaultAction": "SCMP_ACT_ERRNO", "syscalls": [{"name": "frobnicate", "action": "SCMP_ACT_ALLOW"}]}`,
+			err:     `syscalls[0]: unknown syscall "frobnicate"`,
+		},
+		{
+			name:    "unknown capability",
+			profile: `{"defaultAction": "SCMP_ACT_ERRNO", "syscalls": [{"name": "read", "action": "SCMP_ACT_ALLOW", "includes": {"caps": ["CAP_NOPE"]}}]}`,
+			err:     `syscalls[0]: includes: unknown capability "CAP_NOPE"`,
+		},
+		{
+			name:    "bad minKernel",
+			profile: `{"defaultAction": "SCMP_ACT_ERRNO", "syscalls": [{"name": "read", "action": "SCMP_ACT_ALLOW", "excludes": {"minKernel": "4"}}]}`,
+			err:     `syscalls[0]: excludes: invalid minKernel "4"`,
+		},
+		{
+			name:    "errnoRet without errno",
+			profile: `{"defaultAction": "SCMP_ACT_ERRNO", "syscalls": [{"name": "read", "action": "SCMP_ACT_ALLOW", "errnoRet": 1}]}`,
+			err:     `syscalls[0]: errnoRet: only valid with action SCMP_ACT_ERRNO`,
+		},
+		{
+			name:    "defaultErrnoRet without errno",
+			profile: `{"defaultAction": "SCMP_ACT_ALLOW", "defaultErrnoRet": 1, "syscalls": []}`,
+			err:     `defaultErrnoRet: only valid with defaultAction SCMP_ACT_ERRNO`,
+		},
+		{
+			name:    "unknown field",
+			profile: `{"defaultAction": "SCMP_ACT_ERRNO", "syscalls": [], "sycalls": []}`,
+			err:     `unknown field "sycalls"`,
+		},
+	} {
+		_, err := parseSeccomp(strings.NewReader(tc.profile))
+		switch {
+		case tc.err == "" && err != nil:
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
+		case tc.err != "" && err == nil:
+			t.Errorf("%s: expected error %q", tc.name, tc.err)
+		case tc.err != "" && !strings.Contains(err.Error(), tc.err):
+			t.Errorf("%s: expected error %q, got: %v", tc.name, tc.err, err)
+		}
+	}
+}
+
+func TestParseSeccompErrnoRet(t *testing.T) {
+	s, err := parseSeccomp(strings.NewReader(`{"defaultAction": "SCMP_ACT_ERRNO", "defaultErrnoRet": 1, "syscalls": [{"name": "bpf", "action": "SCMP_ACT_ERRNO", "errnoRet": 38, "args": []}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.DefaultErrnoRet == nil || *s.DefaultErrnoRet != 1 || s.Syscalls[0].ErrnoRet == nil || *s.Syscalls[0].ErrnoRet != 38 {
+		t.Fatalf("errno values not parsed: %+v", s)
+	}
+
+	// the profile passed to the docker daemon keeps them
+	b, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := parseSeccomp(strings.NewReader(string(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(s, again) {
+		t.Errorf("profile changed encoding it:\n%s", b)
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+)
+
+// serverTLSConfig returns the TLS configuration of the web server. When
+// clientCA is set, clients must present a certificate signed by it.
+func serverTLSConfig(clientCA string) (*tls.Config, error) {
+	cfg := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+	if clientCA != "" {
+		pool, err := certPool(clientCA)
+		if err != nil {
+			return nil, err
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return cfg, nil
+}
+
+// certResearcher returns the researcher identified by the verified client
+// certificate of r, the common name of its subject. ok is false when r has
+// no client certificate.
+func certResearcher(r *http.Request) (researcher string, ok bool, err error) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		return "", false, nil
+	}
+	subject := r.TLS.VerifiedChains[0][0].Subject
+	if !researcherID.MatchString(subject.CommonName) {
+		return "", true, fmt.Errorf("client certificate common name %q is not a valid researcher ID", subject.CommonName)
+	}
+	return subject.CommonName, true, nil
+}
@@ -2,52 +2,87 @@ package main
 
 import (
 	"context"
-	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
-	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
 
 	"github.com/docker/docker/api/types"
-	"github.com/docker/docker/client"
 	"github.com/gorilla/websocket"
 	"github.com/sirupsen/logrus"
 )
 
-const (
-	dockerAPIVersion = "v1.35"
-)
-
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
+	Subprotocols:    []string{tokenProtocol},
 }
 
 type handler struct {
-	// parameters for normal docker daemon
-	dcli      *client.Client
-	dockerURL *url.URL
-
-	// parameters for docker daemon with user namespace enabled
-	dUserNSCli      *client.Client
-	dockerUserNSURL *url.URL
-
-	tlsConfig *tls.Config
-	tls_ws     bool
+	// backends of the normal docker daemon and of the one with user
+	// namespaces enabled
+	docker       backend
+	dockerUserNS backend
+
+	// profiles holds the docker profiles containers can be started with,
+	// they are swapped by reloadProfiles.
+	profiles    map[string]*profile
+	profilesMu  sync.RWMutex
+	reloadMu    sync.Mutex
+	profilesDir string
+	hostOS      string
+
+	// instanceID identifies this server in the labels of the containers it
+	// creates and sessions holds the live sessions by ID.
+	instanceID string
+	sessions   map[string]*containerInfo
+	sessionsMu sync.Mutex
+
+	// ports leases the host ports containers are published on.
+	ports *portAllocator
+	// limiter caps the number of concurrent sessions, rateLimiter how often
+	// a client can start one and maxClientSessions how many a client can
+	// have at once.
+	limiter           *sessionLimiter
+	rateLimiter       *rateLimiter
+	maxClientSessions int
+
+	// negotiated records the docker daemons the API version was negotiated
+	// with, by userns.
+	negotiated  map[bool]bool
+	negotiateMu sync.Mutex
+
+	// daemonFeatures holds what each docker daemon supports, by userns.
+	daemonFeatures map[bool]*daemonFeatures
+	featuresMu     sync.Mutex
+
+	// recorder records the sessions, they are not recorded when it is nil.
+	recorder *recorder
+
+	// resumeGrace is how long the container of a session is kept after its
+	// browser went away, for the browser to resume it.
+	resumeGrace time.Duration
+
+	// tokenSecret signs the access tokens of researchers, authentication
+	// is disabled when it is nil.
+	tokenSecret []byte
+	// reviewers are the researchers who may watch the sessions of the
+	// others.
+	reviewers map[string]bool
+
+	// draining is set to 1 once the server is shutting down.
+	draining int32
 }
 
-func (h *handler) client(userns bool) *client.Client {
+func (h *handler) backend(userns bool) backend {
 	if userns {
-		return h.dUserNSCli
+		return h.dockerUserNS
 	}
-	return h.dcli
-}
-func (h *handler) url(userns bool) *url.URL {
-	if userns {
-		return h.dockerUserNSURL
-	}
-	return h.dockerURL
+	return h.docker
 }
 
 type message struct {
@@ -55,6 +90,28 @@ type message struct {
 	Data   string `json:"data"`
 	Height uint   `json:"height,omitempty"`
 	Width  uint   `json:"width,omitempty"`
+	// Terminal is the ID of the terminal of the session the message is
+	// about, empty for the terminal of the container itself.
+	Terminal string `json:"terminal,omitempty"`
+}
+
+// lockedConn is a websocket connection that can be written to from multiple
+// goroutines.
+type lockedConn struct {
+	*websocket.Conn
+	mu sync.Mutex
+}
+
+func (c *lockedConn) WriteJSON(v interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.Conn.WriteJSON(v)
+}
+
+func (c *lockedConn) WriteMessage(messageType int, data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.Conn.WriteMessage(messageType, data)
 }
 
 // pingHander returns pong.
@@ -67,23 +124,36 @@ func pingHandler(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprint(w, "pong")
 }
 
-func constructContainerInfo(r *http.Request) (*containerInfo, error) {
-	var c containerInfo
-	if len(r.URL.Query()["port"]) > 0 {
-		c.port = r.URL.Query()["port"][0]
+func constructContainerInfo(r *http.Request, profiles map[string]*profile) (*containerInfo, error) {
+	c := containerInfo{
+		sessionID:   newID(),
+		resumeToken: newID(),
+		spectators:  newSpectators(),
+		screen:      newRingBuffer(resumeBufferSize),
+		removed:     make(chan struct{}),
+	}
+	// The browser only asks for ports to be opened, which ones is up to the
+	// port allocator. A port given by older frontends just opens ports.
+	if len(r.URL.Query()["ports"]) > 0 {
+		c.openPorts = r.URL.Query()["ports"][0] == "enabled"
+	}
+	if len(r.URL.Query()["port"]) > 0 && r.URL.Query()["port"][0] != "" {
+		c.openPorts = true
 	}
 
 	if len(r.URL.Query()["image"]) > 0 {
 		c.dockerImage = r.URL.Query()["image"][0]
 	}
 
+	var profileName string
 	if len(r.URL.Query()["profile"]) > 0 {
-		c.dockerProfile = dockerProfile(r.URL.Query()["profile"][0])
-
-		if _, ok := dockerProfiles[c.dockerProfile]; !ok {
-			return nil, fmt.Errorf("Docker profile %q is invalid.", c.dockerProfile)
-		}
+		profileName = r.URL.Query()["profile"][0]
 	}
+	p, ok := profiles[profileName]
+	if !ok {
+		return nil, fmt.Errorf("Docker profile %q is invalid.", profileName)
+	}
+	c.profile = p
 
 	if len(r.URL.Query()["userns"]) > 0 {
 		val := r.URL.Query()["userns"][0]
@@ -116,15 +186,47 @@ func constructContainerInfo(r *http.Request) (*containerInfo, error) {
 }
 
 func (h *handler) profilesHandler(w http.ResponseWriter, r *http.Request) {
-	conn, err := upgrader.Upgrade(w, r, nil)
+	wsConn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		logrus.Errorf("websocket upgrader failed: %v", err)
 		return
 	}
+	conn := &lockedConn{Conn: wsConn}
+
+	if h.isDraining() {
+		if err := conn.WriteJSON(message{
+			Type: "stdout",
+			Data: "server is shutting down, try again later",
+		}); err != nil {
+			logrus.Errorf("writing error message to browser websocket failed: %v", err)
+		}
+		conn.Close()
+		return
+	}
+
+	researcher, err := h.authenticate(r)
+	if err != nil {
+		logrus.Warnf("unauthenticated session from %s: %v", r.RemoteAddr, err)
+		rejectSession(conn, websocket.ClosePolicyViolation, fmt.Sprintf("Authentication failed: %v.", err))
+		return
+	}
+
+	// a browser coming back to its session
+	if token := r.URL.Query().Get("resume"); token != "" {
+		h.resumeSession(conn, token, researcher)
+		return
+	}
+
+	client := clientKey(r, researcher)
+	if !h.rateLimiter.allow(client) {
+		logrus.WithField("researcher", researcher).Warnf("rate limited session from %s", client)
+		rejectSession(conn, websocket.CloseTryAgainLater, "Too many sessions started, wait a minute and try again.")
+		return
+	}
 
-	ctrInfo, err := constructContainerInfo(r)
+	ctrInfo, err := constructContainerInfo(r, h.getProfiles())
 	if err != nil {
-		logrus.Errorf("generating container info failed: %v", err)
+		logrus.WithField("researcher", researcher).Errorf("generating container info failed: %v", err)
 		data := message{
 			Type: "stdout",
 			Data: fmt.Sprintf("generating container info failed: %v", err),
@@ -135,123 +237,242 @@ func (h *handler) profilesHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// start the container and create the container websocket connection
-	containerWSConn, err := h.startContainer(ctrInfo)
+	ctrInfo.researcher = researcher
+	ctrInfo.client = client
+	log := ctrInfo.logger()
+
+	if err := h.checkProfile(ctrInfo); err != nil {
+		log.Errorf("checking profile failed: %v", err)
+		rejectSession(conn, websocket.ClosePolicyViolation, err.Error())
+		return
+	}
+
+	// track the session before creating its container so it is not reaped
+	ctrInfo.browser = conn
+	ctrInfo.slot = h.limiter.enqueue(ctrInfo.profile)
+	if err := h.trackSession(ctrInfo); err != nil {
+		h.limiter.release(ctrInfo.slot)
+		log.Warnf("rejected session from %s: %v", ctrInfo.client, err)
+		rejectSession(conn, websocket.CloseTryAgainLater, err.Error())
+		return
+	}
+
+	// read from the browser websocket in a go routine so the browser going
+	// away is noticed while waiting in the queue
+	stopReading := make(chan struct{})
+	defer close(stopReading)
+	msgs := readBrowser(conn, stopReading, log)
+
+	// wait for a free slot
+	resize, ok := h.waitForSlot(ctrInfo, conn, msgs)
+	if !ok {
+		log.Info("browser left the queue")
+		if err := h.removeContainer(ctrInfo); err != nil {
+			log.Errorf("removing container %s failed: %v", ctrInfo.containerid, err)
+		}
+		return
+	}
+	if h.isDraining() {
+		if err := h.removeContainer(ctrInfo); err != nil {
+			log.Errorf("removing container %s failed: %v", ctrInfo.containerid, err)
+		}
+		if err := conn.WriteJSON(message{
+			Type: "stdout",
+			Data: "server is shutting down, try again later",
+		}); err != nil {
+			log.Errorf("writing error message to browser websocket failed: %v", err)
+		}
+		conn.Close()
+		return
+	}
+
+	// start the container and attach to it
+	attach, err := h.startContainer(ctrInfo)
 	if err != nil {
-		logrus.Errorf("starting container failed: %v", err)
+		log.Errorf("starting container failed: %v", err)
+		// cleanup and remove the container if it was created
+		if err := h.removeContainer(ctrInfo); err != nil {
+			log.Errorf("removing container %s failed: %v", ctrInfo.containerid, err)
+		}
 		data := message{
 			Type: "stdout",
 			Data: fmt.Sprintf("starting container failed: %v", err),
 		}
 		if err := conn.WriteJSON(data); err != nil {
-			logrus.Errorf("writing error message to browser websocket failed: %v", err)
+			log.Errorf("writing error message to browser websocket failed: %v", err)
 		}
 		return
 	}
-	defer containerWSConn.Close()
-	logrus.Infof("container started with id: %s", ctrInfo.containerid)
+	log.Infof("container started with id: %s", ctrInfo.containerid)
 
-	// start a go routine to listen on the container websocket and send to the browser websocket
-	done := make(chan struct{})
-	go func() {
-		defer containerWSConn.Close()
-		defer close(done)
-
-		for {
-			// TODO: this will panic if we couldn't start the container
-			_, msg, err := containerWSConn.ReadMessage()
-			if err != nil {
-				if e, ok := err.(*websocket.CloseError); ok {
-					logrus.Warnf("container websocket closed %s %d", e.Text, e.Code)
-					// cleanup and remove the container
-					if err := h.removeContainer(ctrInfo); err != nil {
-						logrus.Errorf("removing container %s failed: %v", ctrInfo.containerid, err)
-					}
-					// cleanly close the browser connection
-					if err := conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")); err != nil {
-						logrus.Errorf("closing browser websocket failed: %v", err)
-					}
-					break
-				}
-				if err == io.EOF {
-					continue
-				}
-				logrus.Errorf("reading from container websocket failed: %v", err)
-				continue
-			}
-			logrus.Debugf("received from container websocket: %s", string(msg))
+	// record the session, it carries on unrecorded if that fails
+	ctrInfo.recording, err = h.recorder.record(ctrInfo)
+	if err != nil {
+		log.Errorf("recording session failed: %v", err)
+	}
+	ctrInfo.start(attach, newSessionTimer(ctrInfo.profile.Session))
+
+	// tell the browser how to come back to the session if it goes away
+	if h.resumeGrace > 0 {
+		if err := conn.WriteJSON(message{
+			Type: "session",
+			Data: ctrInfo.resumeToken,
+		}); err != nil {
+			log.Errorf("writing session message to browser websocket failed: %v", err)
+		}
+	}
 
-			// send it back through to the browser websocket as a binary frame
-			b := message{
-				Type: "stdout",
-				Data: string(msg),
-			}
-			if err := conn.WriteJSON(b); err != nil {
-				if err == websocket.ErrCloseSent {
-					logrus.Warn("browser websocket close sent")
-					// cleanup and remove the container
-					if err := h.removeContainer(ctrInfo); err != nil {
-						logrus.Errorf("removing container %s failed: %v", ctrInfo.containerid, err)
-					}
-					break
-				}
-				logrus.Errorf("writing to browser websocket failed: %v", err)
-				continue
-			}
-			logrus.Debugf("wrote to browser websocket: %#v", b)
+	// tell the browser which ports were opened for it
+	if len(ctrInfo.ports) > 0 {
+		ports := make([]string, 0, len(ctrInfo.ports))
+		for _, port := range ctrInfo.ports {
+			ports = append(ports, string(port))
 		}
-	}()
+		if err := conn.WriteJSON(message{
+			Type: "ports",
+			Data: "Container ports: " + strings.Join(ports, ", "),
+		}); err != nil {
+			log.Errorf("writing ports message to browser websocket failed: %v", err)
+		}
+	}
+
+	// start a go routine to expire the session
+	go h.enforceSessionLimits(ctrInfo)
+
+	// start a go routine to read from the container and send to the browser
+	// websocket, it ends the session once the container is gone
+	go h.relayOutput(ctrInfo)
+
+	// apply the last size the browser asked for while waiting
+	if resize != nil {
+		h.resizeContainer(ctrInfo, resize.Height, resize.Width)
+	}
+
+	h.serveBrowser(ctrInfo, conn, msgs)
+}
 
+// relayOutput reads from the container of a session and sends the output to
+// the browser, the spectators and the recording. Once the container output
+// ends, the container is removed and the browser websocket closed.
+func (h *handler) relayOutput(ctrInfo *containerInfo) {
+	log := ctrInfo.logger()
+	defer ctrInfo.recording.Close()
+
+	buf := make([]byte, 32*1024)
+	var pending []byte
 	for {
-		var data message
-		if err := conn.ReadJSON(&data); err != nil {
-			if e, ok := err.(*websocket.CloseError); ok {
-				logrus.Warnf("browser websocket closed %s %d", e.Text, e.Code)
-				// cleanup and remove the container
-				if err := h.removeContainer(ctrInfo); err != nil {
-					logrus.Errorf("removing container %s failed: %v", ctrInfo.containerid, err)
+		n, err := ctrInfo.tty.Read(buf)
+		if n > 0 {
+			// keep a multi-byte character split between reads for the next one
+			var out []byte
+			out, pending = splitUTF8(append(pending, buf[:n]...))
+			log.Debugf("received from container: %q", out)
+			ctrInfo.output(out)
+		}
+		if err != nil {
+			switch {
+			case ctrInfo.isRemoved():
+				log.Info("container removed")
+			case err == io.EOF:
+				ctr, err := h.backend(ctrInfo.userns).Inspect(context.Background(), ctrInfo.containerid)
+				if err == nil && ctr.State != nil {
+					log.Infof("container output closed, exit code: %d", ctr.State.ExitCode)
+				} else {
+					log.Info("container output closed")
 				}
-				break
+			default:
+				log.Errorf("reading from container failed: %v", err)
 			}
-			logrus.Errorf("reading from browser websocket failed: %v", err)
-			continue
+			// cleanup and remove the container
+			if err := h.removeContainer(ctrInfo); err != nil {
+				log.Errorf("removing container %s failed: %v", ctrInfo.containerid, err)
+			}
+			// cleanly close the browser connection
+			ctrInfo.closeBrowser(websocket.CloseNormalClosure, "")
+			return
 		}
-		logrus.Debugf("recieved from browser websocket: %#v", data)
+	}
+}
 
-		// send to container websocket or resize
+// serveBrowser sends the input of the browser to the container of a started
+// session until the browser goes away.
+func (h *handler) serveBrowser(ctrInfo *containerInfo, conn *lockedConn, msgs <-chan message) {
+	log := ctrInfo.logger()
+	for data := range msgs {
+		if data.Terminal != "" {
+			h.serveTerminal(ctrInfo, data)
+			continue
+		}
+		// send to container, resize or open another terminal
 		switch data.Type {
 		case "stdin":
+			ctrInfo.timer.touch()
 			if len(data.Data) > 0 {
-				if err := containerWSConn.WriteMessage(websocket.TextMessage, []byte(data.Data)); err != nil {
-					if err == websocket.ErrCloseSent {
-						logrus.Warn("container websocket close sent")
-						// cleanup and remove the container
-						if err := h.removeContainer(ctrInfo); err != nil {
-							logrus.Errorf("removing container %s failed: %v", ctrInfo.containerid, err)
-						}
-						break
+				// record the input before the output it causes
+				ctrInfo.recording.input(data.Data)
+				if _, err := ctrInfo.tty.Write([]byte(data.Data)); err != nil {
+					log.Errorf("writing to container failed: %v", err)
+					// cleanup and remove the container
+					if err := h.removeContainer(ctrInfo); err != nil {
+						log.Errorf("removing container %s failed: %v", ctrInfo.containerid, err)
 					}
-					logrus.Errorf("writing to container websocket failed: %v", err)
 					continue
 				}
-				logrus.Debugf("wrote to container websocket: %q", data.Data)
+				log.Debugf("wrote to container: %q", data.Data)
 			}
 		case "resize":
-			if err := h.dcli.ContainerResize(context.Background(), ctrInfo.containerid, types.ResizeOptions{
-				Height: data.Height,
-				Width:  data.Width,
-			}); err != nil {
-				logrus.Errorf("resize container to height -> %d, width: %d failed: %v", data.Height, data.Width, err)
-			}
+			h.resizeContainer(ctrInfo, data.Height, data.Width)
+		case "terminal":
+			h.openTerminal(ctrInfo, data.Height, data.Width)
 		default:
-			logrus.Warnf("got unknown data type: %s", data.Type)
+			log.Warnf("got unknown data type: %s", data.Type)
 		}
 	}
 
-	// cleanup and remove the container
-	if err := h.removeContainer(ctrInfo); err != nil {
-		logrus.Errorf("removing container %s failed: %v", ctrInfo.containerid, err)
+	h.browserLeft(ctrInfo, conn)
+}
+
+// readBrowser reads the messages from the browser websocket until it is
+// closed or done is closed. Messages that are not valid JSON are skipped.
+func readBrowser(conn *lockedConn, done <-chan struct{}, log *logrus.Entry) <-chan message {
+	msgs := make(chan message)
+	go func() {
+		defer close(msgs)
+		for {
+			var data message
+			if err := conn.ReadJSON(&data); err != nil {
+				if e, ok := err.(*websocket.CloseError); ok {
+					log.Warnf("browser websocket closed %s %d", e.Text, e.Code)
+					return
+				}
+				switch err.(type) {
+				case *json.SyntaxError, *json.UnmarshalTypeError:
+					log.Errorf("reading from browser websocket failed: %v", err)
+					continue
+				}
+				log.Errorf("reading from browser websocket failed, closing it: %v", err)
+				return
+			}
+			log.Debugf("recieved from browser websocket: %#v", data)
+
+			select {
+			case msgs <- data:
+			case <-done:
+				return
+			}
+		}
+	}()
+	return msgs
+}
+
+// resizeContainer resizes the tty of the container of a session.
+func (h *handler) resizeContainer(ctrInfo *containerInfo, height, width uint) {
+	if err := h.backend(ctrInfo.userns).Resize(context.Background(), ctrInfo.containerid, height, width); err != nil {
+		ctrInfo.logger().Errorf("resize container to height -> %d, width: %d failed: %v", height, width, err)
+		return
 	}
+	ctrInfo.recording.resize(height, width)
+	ctrInfo.spectators.resize(height, width)
 }
 
 // infoHander returns information about the connected docker daemon.
@@ -260,7 +481,7 @@ func (h *handler) infoHandler(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusNotFound)
 		return
 	}
-	if err := retrieveInfo(w, r, h.dcli); err != nil {
+	if err := retrieveInfo(w, r, h.docker); err != nil {
 		logrus.Errorf("docker: %v", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
@@ -274,21 +495,30 @@ func (h *handler) infoUserNSHandler(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusNotFound)
 		return
 	}
-	if err := retrieveInfo(w, r, h.dUserNSCli); err != nil {
+	if err := h.ready(true); err != nil {
+		logrus.Errorf("docker user namespace: %v", err)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	if err := retrieveInfo(w, r, h.dockerUserNS); err != nil {
 		logrus.Errorf("docker user namespace: %v", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 }
 
-func retrieveInfo(w http.ResponseWriter, r *http.Request, client *client.Client) error {
+func retrieveInfo(w http.ResponseWriter, r *http.Request, daemon backend) error {
 
-	info, err := client.Info(context.Background())
+	info, err := daemon.Info(context.Background())
 	if err != nil {
 		return fmt.Errorf("getting docker info failed: %v", err)
 	}
 
-	b, err := json.MarshalIndent(info, "", "  ")
+	// add the API version negotiated with the daemon
+	b, err := json.MarshalIndent(struct {
+		types.Info
+		APIVersion string
+	}{info, daemon.APIVersion()}, "", "  ")
 	if err != nil {
 		return fmt.Errorf("marshal indent info failed: %v", err)
 	}
@@ -297,3 +527,19 @@ func retrieveInfo(w http.ResponseWriter, r *http.Request, client *client.Client)
 	fmt.Fprintf(w, "%s", b)
 	return nil
 }
+
+// splitUTF8 splits b before a multi-byte UTF-8 character cut off at its end.
+func splitUTF8(b []byte) (complete, rest []byte) {
+	// a character is at most utf8.UTFMax bytes long
+	for i := 1; i < utf8.UTFMax && i <= len(b); i++ {
+		start := len(b) - i
+		if !utf8.RuneStart(b[start]) {
+			continue
+		}
+		if !utf8.FullRune(b[start:]) {
+			return b[:start], append([]byte(nil), b[start:]...)
+		}
+		break
+	}
+	return b, nil
+}
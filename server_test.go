@@ -0,0 +1,602 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/sirupsen/logrus"
+)
+
+// testTimeout is how long the tests wait for the server to do something.
+const testTimeout = 5 * time.Second
+
+func TestMain(m *testing.M) {
+	logrus.SetOutput(ioutil.Discard)
+	os.Exit(m.Run())
+}
+
+// testServer serves the session endpoints of a handler running its
+// containers on fake backends.
+type testServer struct {
+	*httptest.Server
+	h            *handler
+	docker       *fakeBackend
+	dockerUserNS *fakeBackend
+}
+
+// newTestServer starts a server with the profiles in the profiles directory
+// and no limits. configure, if not nil, can change the handler before the
+// server starts.
+func newTestServer(t *testing.T, configure func(h *handler)) *testServer {
+	t.Helper()
+	profiles, err := loadProfiles("profiles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ports, err := newPortAllocator(defaultPortRange)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rateLimiter, err := newRateLimiter(0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &testServer{
+		docker:       newFakeBackend(),
+		dockerUserNS: newFakeBackend(),
+	}
+	s.h = &handler{
+		docker:       s.docker,
+		dockerUserNS: s.dockerUserNS,
+
+		profiles:    profiles,
+		profilesDir: "profiles",
+
+		instanceID: "test",
+		sessions:   map[string]*containerInfo{},
+
+		ports:       ports,
+		limiter:     newSessionLimiter(0),
+		rateLimiter: rateLimiter,
+	}
+	if configure != nil {
+		configure(s.h)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/info", s.h.requireAuth(s.h.infoHandler))
+	mux.HandleFunc("/profiles", s.h.profilesHandler)
+	mux.HandleFunc("/replay", s.h.replayHandler)
+	mux.HandleFunc("/spectate", s.h.spectateHandler)
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+// testSecret signs the access tokens of the tests.
+var testSecret = []byte(strings.Repeat("s", minTokenSecret))
+
+// testToken returns an access token for researcher signed with testSecret.
+func testToken(t *testing.T, researcher string) string {
+	t.Helper()
+	token, err := issueToken(testSecret, researcher, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// dial opens a session with the query parameters in query.
+func (s *testServer) dial(t *testing.T, query string) *websocket.Conn {
+	t.Helper()
+	u := "ws" + strings.TrimPrefix(s.URL, "http") + "/profiles?" + query
+	conn, _, err := websocket.DefaultDialer.Dial(u, nil)
+	if err != nil {
+		t.Fatalf("dialing %s: %v", u, err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// waitFor fails the test if cond does not become true in time.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(testTimeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// waitForContainers waits until the backend has n containers and returns
+// them.
+func waitForContainers(t *testing.T, b *fakeBackend, n int) []fakeContainer {
+	t.Helper()
+	var ctrs []fakeContainer
+	waitFor(t, "containers", func() bool {
+		ctrs = b.snapshot()
+		return len(ctrs) == n && (n == 0 || ctrs[n-1].running)
+	})
+	return ctrs
+}
+
+// readMessage reads the next message of type typ from the browser end of a
+// session, skipping the others.
+func readMessage(t *testing.T, conn *websocket.Conn, typ string) message {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(testTimeout))
+	for {
+		var msg message
+		if err := conn.ReadJSON(&msg); err != nil {
+			t.Fatalf("reading %s message: %v", typ, err)
+		}
+		if msg.Type == typ {
+			return msg
+		}
+	}
+}
+
+// readOutput reads the output of the container until it contains want and
+// returns it.
+func readOutput(t *testing.T, conn *websocket.Conn, want string) string {
+	t.Helper()
+	var out string
+	for !strings.Contains(out, want) {
+		out += readMessage(t, conn, "stdout").Data
+	}
+	return out
+}
+
+// expectClose reads from the browser end of a session until the server
+// closes it with code.
+func expectClose(t *testing.T, conn *websocket.Conn, code int) {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(testTimeout))
+	for {
+		_, _, err := conn.ReadMessage()
+		if err == nil {
+			continue
+		}
+		if !websocket.IsCloseError(err, code) {
+			t.Fatalf("expected close with code %d, got: %v", code, err)
+		}
+		return
+	}
+}
+
+func closeSession(t *testing.T, conn *websocket.Conn) {
+	t.Helper()
+	if err := conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")); err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+}
+
+func send(t *testing.T, conn *websocket.Conn, msg message) {
+	t.Helper()
+	if err := conn.WriteJSON(msg); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSession(t *testing.T) {
+	s := newTestServer(t, nil)
+	conn := s.dial(t, "profile=default-docker")
+
+	ctr := waitForContainers(t, s.docker, 1)[0]
+	if ctr.id != "fake0001" {
+		t.Errorf("expected container fake0001, got %s", ctr.id)
+	}
+	if ctr.config.Image != defaultDockerImage {
+		t.Errorf("expected image %s, got %s", defaultDockerImage, ctr.config.Image)
+	}
+	if ctr.config.User != "nobody" {
+		t.Errorf("expected user nobody, got %q", ctr.config.User)
+	}
+	if got := ctr.config.Labels[profileLabel]; got != "default-docker" {
+		t.Errorf("expected profile label default-docker, got %q", got)
+	}
+	if got := ctr.config.Labels[instanceLabel]; got != "test" {
+		t.Errorf("expected instance label test, got %q", got)
+	}
+	if !s.h.isLiveSession(ctr.config.Labels[sessionLabel]) {
+		t.Errorf("session %q of the container is not live", ctr.config.Labels[sessionLabel])
+	}
+	if _, ok := ctr.config.Labels[researcherLabel]; ok {
+		t.Error("expected no researcher label without authentication")
+	}
+	if ctr.hostCfg.PidsLimit != 5 {
+		t.Errorf("expected pids limit 5, got %d", ctr.hostCfg.PidsLimit)
+	}
+	if len(s.dockerUserNS.snapshot()) != 0 {
+		t.Error("expected no containers on the user namespace enabled daemon")
+	}
+
+	send(t, conn, message{Type: "stdin", Data: "echo hello\n"})
+	readOutput(t, conn, "echo hello\n")
+
+	send(t, conn, message{Type: "resize", Height: 40, Width: 120})
+	waitFor(t, "resize", func() bool {
+		ctrs := s.docker.snapshot()
+		return len(ctrs) == 1 && ctrs[0].height == 40 && ctrs[0].width == 120
+	})
+
+	closeSession(t, conn)
+	waitForContainers(t, s.docker, 0)
+	waitFor(t, "session to end", func() bool { return len(s.h.liveSessions()) == 0 })
+}
+
+func TestSessionMultiByteOutput(t *testing.T) {
+	s := newTestServer(t, nil)
+	conn := s.dial(t, "profile=default-docker")
+	waitForContainers(t, s.docker, 1)
+
+	send(t, conn, message{Type: "stdin", Data: "héllo wörld ✓\n"})
+	readOutput(t, conn, "héllo wörld ✓\n")
+}
+
+func TestSessionUserNS(t *testing.T) {
+	s := newTestServer(t, nil)
+	s.dial(t, "profile=weak-docker&userns=enabled")
+
+	ctr := waitForContainers(t, s.dockerUserNS, 1)[0]
+	if len(s.docker.snapshot()) != 0 {
+		t.Error("expected no containers on the docker daemon")
+	}
+	if len(ctr.hostCfg.Mounts) != 1 || ctr.hostCfg.Mounts[0].Target != "/var/tmp/shared" {
+		t.Errorf("expected the shared directory to be mounted, got %#v", ctr.hostCfg.Mounts)
+	}
+}
+
+func TestSessionContainerExit(t *testing.T) {
+	s := newTestServer(t, nil)
+	conn := s.dial(t, "profile=default-docker")
+	ctr := waitForContainers(t, s.docker, 1)[0]
+
+	if err := s.docker.exit(ctr.id, 1); err != nil {
+		t.Fatal(err)
+	}
+	expectClose(t, conn, websocket.CloseNormalClosure)
+	waitForContainers(t, s.docker, 0)
+	waitFor(t, "session to end", func() bool { return len(s.h.liveSessions()) == 0 })
+}
+
+func TestSessionUnknownProfile(t *testing.T) {
+	s := newTestServer(t, nil)
+	conn := s.dial(t, "profile=nope")
+
+	msg := readMessage(t, conn, "stdout")
+	if !strings.Contains(msg.Data, `"nope" is invalid`) {
+		t.Errorf("expected invalid profile error, got %q", msg.Data)
+	}
+	if len(s.docker.snapshot()) != 0 {
+		t.Error("expected no container to be created")
+	}
+}
+
+func TestSessionPorts(t *testing.T) {
+	s := newTestServer(t, func(h *handler) {
+		p := *h.profiles["default-docker"]
+		p.Ports = []string{"tcp", "udp"}
+		h.profiles["default-docker"] = &p
+	})
+	conn := s.dial(t, "profile=default-docker&ports=enabled")
+
+	msg := readMessage(t, conn, "ports")
+	if msg.Data != "Container ports: 36100/tcp, 36100/udp" {
+		t.Errorf("unexpected ports message %q", msg.Data)
+	}
+	ctr := waitForContainers(t, s.docker, 1)[0]
+	if got := ctr.hostCfg.PortBindings["36100/tcp"]; len(got) != 1 || got[0].HostPort != "36100" {
+		t.Errorf("expected 36100/tcp to be published on 36100, got %#v", got)
+	}
+
+	closeSession(t, conn)
+	waitForContainers(t, s.docker, 0)
+	waitFor(t, "ports to be released", func() bool {
+		s.h.ports.mu.Lock()
+		defer s.h.ports.mu.Unlock()
+		return len(s.h.ports.leases) == 0
+	})
+}
+
+func TestSessionQueue(t *testing.T) {
+	s := newTestServer(t, func(h *handler) {
+		h.limiter = newSessionLimiter(1)
+	})
+	first := s.dial(t, "profile=default-docker")
+	waitForContainers(t, s.docker, 1)
+
+	second := s.dial(t, "profile=default-docker")
+	msg := readMessage(t, second, "queue")
+	if !strings.Contains(msg.Data, "number 1 in the queue") {
+		t.Errorf("unexpected queue message %q", msg.Data)
+	}
+	// the size asked for while waiting is applied once the container runs
+	send(t, second, message{Type: "resize", Height: 24, Width: 80})
+	if n := len(s.docker.snapshot()); n != 1 {
+		t.Fatalf("expected the queued session to have no container, got %d containers", n)
+	}
+
+	closeSession(t, first)
+	waitFor(t, "the queued session to start", func() bool {
+		ctrs := s.docker.snapshot()
+		return len(ctrs) == 1 && ctrs[0].id == "fake0002" && ctrs[0].height == 24 && ctrs[0].width == 80
+	})
+	send(t, second, message{Type: "stdin", Data: "ls\n"})
+	readOutput(t, second, "ls\n")
+}
+
+func TestSessionClientLimit(t *testing.T) {
+	s := newTestServer(t, func(h *handler) {
+		h.maxClientSessions = 1
+	})
+	s.dial(t, "profile=default-docker")
+	waitForContainers(t, s.docker, 1)
+
+	conn := s.dial(t, "profile=default-docker")
+	msg := readMessage(t, conn, "rejected")
+	if !strings.Contains(msg.Data, "already have 1 sessions running") {
+		t.Errorf("unexpected rejection %q", msg.Data)
+	}
+	expectClose(t, conn, websocket.CloseTryAgainLater)
+	if n := len(s.docker.snapshot()); n != 1 {
+		t.Errorf("expected 1 container, got %d", n)
+	}
+}
+
+func TestSessionRateLimit(t *testing.T) {
+	s := newTestServer(t, func(h *handler) {
+		h.rateLimiter, _ = newRateLimiter(1, 1)
+	})
+	closeSession(t, s.dial(t, "profile=default-docker"))
+
+	conn := s.dial(t, "profile=default-docker")
+	msg := readMessage(t, conn, "rejected")
+	if !strings.Contains(msg.Data, "Too many sessions started") {
+		t.Errorf("unexpected rejection %q", msg.Data)
+	}
+	expectClose(t, conn, websocket.CloseTryAgainLater)
+}
+
+func TestSessionAuth(t *testing.T) {
+	secret := []byte(strings.Repeat("s", minTokenSecret))
+	s := newTestServer(t, func(h *handler) {
+		h.tokenSecret = secret
+	})
+
+	conn := s.dial(t, "profile=default-docker")
+	msg := readMessage(t, conn, "rejected")
+	if !strings.Contains(msg.Data, "missing access token") {
+		t.Errorf("unexpected rejection %q", msg.Data)
+	}
+	expectClose(t, conn, websocket.ClosePolicyViolation)
+
+	expired, err := issueToken(secret, "alice", time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn = s.dial(t, "profile=default-docker&token="+expired)
+	msg = readMessage(t, conn, "rejected")
+	if !strings.Contains(msg.Data, "token expired") {
+		t.Errorf("unexpected rejection %q", msg.Data)
+	}
+
+	token, err := issueToken(secret, "alice", time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.dial(t, "profile=default-docker&token="+token)
+	ctr := waitForContainers(t, s.docker, 1)[0]
+	if got := ctr.config.Labels[researcherLabel]; got != "alice" {
+		t.Errorf("expected researcher label alice, got %q", got)
+	}
+
+	// browsers send the token as a subprotocol, out of the URL
+	u := "ws" + strings.TrimPrefix(s.URL, "http") + "/profiles?profile=default-docker"
+	dialer := websocket.Dialer{Subprotocols: []string{tokenProtocol, token}}
+	conn, resp, err := dialer.Dial(u, nil)
+	if err != nil {
+		t.Fatalf("dialing %s: %v", u, err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	if got := resp.Header.Get("Sec-WebSocket-Protocol"); got != tokenProtocol {
+		t.Errorf("expected subprotocol %s, got %q", tokenProtocol, got)
+	}
+	waitForContainers(t, s.docker, 2)
+}
+
+func TestRequestToken(t *testing.T) {
+	for _, tc := range []struct {
+		name, query, header, protocol, want string
+	}{
+		{name: "none"},
+		{name: "query", query: "q", want: "q"},
+		{name: "header", header: "Bearer h", want: "h"},
+		{name: "subprotocol", protocol: tokenProtocol + ", p", want: "p"},
+		{name: "header before query", query: "q", header: "Bearer h", want: "h"},
+		{name: "subprotocol first", query: "q", header: "Bearer h", protocol: tokenProtocol + ", p", want: "p"},
+		{name: "other subprotocol", query: "q", protocol: "chat, p", want: "q"},
+	} {
+		r := httptest.NewRequest("GET", "/profiles?token="+tc.query, nil)
+		if tc.header != "" {
+			r.Header.Set("Authorization", tc.header)
+		}
+		if tc.protocol != "" {
+			r.Header.Set("Sec-WebSocket-Protocol", tc.protocol)
+		}
+		if got := requestToken(r); got != tc.want {
+			t.Errorf("%s: expected token %q, got %q", tc.name, tc.want, got)
+		}
+	}
+}
+
+func TestSessionUnsupportedProfile(t *testing.T) {
+	s := newTestServer(t, nil)
+	s.docker.apiVersion = "1.22"
+
+	conn := s.dial(t, "profile=default-docker")
+	msg := readMessage(t, conn, "rejected")
+	if !strings.Contains(msg.Data, "pidsLimit (needs API 1.23)") {
+		t.Errorf("unexpected rejection %q", msg.Data)
+	}
+	expectClose(t, conn, websocket.ClosePolicyViolation)
+	if len(s.docker.snapshot()) != 0 {
+		t.Error("expected no container to be created")
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	s := newTestServer(t, nil)
+	s.dockerUserNS.unreachable = 2
+	if err := s.h.negotiate(true, 3, time.Millisecond); err != nil {
+		t.Fatalf("expected negotiating to succeed on the last attempt: %v", err)
+	}
+
+	s.docker.unreachable = 2
+	if err := s.h.negotiate(false, 2, time.Millisecond); err == nil || !strings.Contains(err.Error(), "daemon unreachable") {
+		t.Errorf("expected negotiating to fail, got %v", err)
+	}
+}
+
+func TestUserNSDaemonDown(t *testing.T) {
+	s := newTestServer(t, nil)
+	s.dockerUserNS.unreachable = 1
+
+	// the profiles are still offered while the daemon is down
+	if got := profileNames(s.h.supportedProfiles(s.h.getProfiles())); strings.Join(got, ",") != "default-docker,weak-docker" {
+		t.Errorf("expected every profile to be offered, got %v", got)
+	}
+
+	// and the daemon is asked again once a session needs it
+	s.dial(t, "profile=default-docker&userns=enabled")
+	waitForContainers(t, s.dockerUserNS, 1)
+}
+
+func TestSupportedProfiles(t *testing.T) {
+	s := newTestServer(t, nil)
+	s.dockerUserNS.apiVersion = "1.24"
+
+	if got := profileNames(s.h.supportedProfiles(s.h.getProfiles())); strings.Join(got, ",") != "default-docker" {
+		t.Errorf("expected weak-docker, which has mounts, to be left out, got %v", got)
+	}
+}
+
+func TestInfo(t *testing.T) {
+	secret := []byte(strings.Repeat("s", minTokenSecret))
+	s := newTestServer(t, func(h *handler) {
+		h.tokenSecret = secret
+	})
+
+	resp, err := http.Get(s.URL + "/info")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected status %d without a token, got %d", http.StatusUnauthorized, resp.StatusCode)
+	}
+
+	token, err := issueToken(secret, "alice", time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err = http.Get(s.URL + "/info?token=" + token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var info struct {
+		OperatingSystem string
+		APIVersion      string
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		t.Fatal(err)
+	}
+	if info.OperatingSystem != "fake" || info.APIVersion != "1.38" {
+		t.Errorf("unexpected info %+v", info)
+	}
+}
+
+func TestReapOrphans(t *testing.T) {
+	s := newTestServer(t, nil)
+	s.dial(t, "profile=default-docker")
+	live := waitForContainers(t, s.docker, 1)[0]
+
+	orphan := s.docker.add(map[string]string{sessionLabel: "gone", profileLabel: "default-docker", instanceLabel: "test"})
+	orphanUserNS := s.dockerUserNS.add(map[string]string{sessionLabel: "gone", instanceLabel: "test"})
+	other := s.docker.add(map[string]string{"com.example": "unrelated"})
+	// the live sessions of another server sharing the daemon are its own
+	otherInstance := s.docker.add(map[string]string{sessionLabel: "elsewhere", instanceLabel: "other"})
+
+	s.h.reapOrphans()
+
+	var ids []string
+	for _, ctr := range s.docker.snapshot() {
+		ids = append(ids, ctr.id)
+	}
+	if strings.Join(ids, ",") != live.id+","+other+","+otherInstance {
+		t.Errorf("expected containers %s, %s and %s to be kept and %s removed, got %v", live.id, other, otherInstance, orphan, ids)
+	}
+	if n := len(s.dockerUserNS.snapshot()); n != 0 {
+		t.Errorf("expected %s to be removed from the user namespace enabled daemon, %d containers left", orphanUserNS, n)
+	}
+}
+
+func TestLoadInstanceID(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "state", "instance-id")
+
+	id, err := loadInstanceID(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id == "" {
+		t.Fatal("expected an instance ID to be generated")
+	}
+	// a restarted server reads the same ID back
+	again, err := loadInstanceID(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again != id {
+		t.Errorf("expected instance ID %s to be kept, got %s", id, again)
+	}
+
+	if err := ioutil.WriteFile(file, []byte("\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadInstanceID(file); err == nil {
+		t.Error("expected an empty instance ID file to be rejected")
+	}
+}
+
+func TestRemoveBeforeCreate(t *testing.T) {
+	s := newTestServer(t, nil)
+	ctrInfo := &containerInfo{
+		sessionID: newID(),
+		profile:   s.h.getProfiles()["default-docker"],
+		removed:   make(chan struct{}),
+	}
+
+	// like a shutdown while the session waits for its container
+	if err := s.h.removeContainer(ctrInfo); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.h.startContainer(ctrInfo); err == nil {
+		t.Error("expected starting the container of a removed session to fail")
+	}
+	if n := len(s.docker.snapshot()); n != 0 {
+		t.Errorf("expected no container to be created, got %d", n)
+	}
+}
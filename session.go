@@ -0,0 +1,262 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"io"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/websocket"
+)
+
+// resumeBufferSize is how much of the latest output of a terminal is kept
+// for a browser resuming the session.
+const resumeBufferSize = 64 * 1024
+
+// ringBuffer holds the latest output of a terminal in a fixed-size buffer,
+// so keeping it costs only the length of each write however busy the
+// terminal is.
+type ringBuffer struct {
+	buf []byte
+	// start is where the oldest output is, n how much output is held.
+	start int
+	n     int
+}
+
+func newRingBuffer(size int) *ringBuffer {
+	return &ringBuffer{buf: make([]byte, size)}
+}
+
+// write appends p, overwriting the oldest output once the buffer is full.
+func (r *ringBuffer) write(p []byte) {
+	size := len(r.buf)
+	if len(p) >= size {
+		copy(r.buf, p[len(p)-size:])
+		r.start, r.n = 0, size
+		return
+	}
+	end := (r.start + r.n) % size
+	copied := copy(r.buf[end:], p)
+	copy(r.buf, p[copied:])
+	r.n += len(p)
+	if r.n > size {
+		r.start = (r.start + r.n - size) % size
+		r.n = size
+	}
+}
+
+// String returns the output held, starting on a character boundary.
+func (r *ringBuffer) String() string {
+	out := make([]byte, 0, r.n)
+	if end := r.start + r.n; end <= len(r.buf) {
+		out = append(out, r.buf[r.start:end]...)
+	} else {
+		out = append(out, r.buf[r.start:]...)
+		out = append(out, r.buf[:end-len(r.buf)]...)
+	}
+	for len(out) > 0 && !utf8.RuneStart(out[0]) {
+		out = out[1:]
+	}
+	return string(out)
+}
+
+// start records that the container of the session runs, attached to tty.
+func (c *containerInfo) start(tty io.ReadWriteCloser, timer *sessionTimer) {
+	c.browserMu.Lock()
+	defer c.browserMu.Unlock()
+	c.tty = tty
+	c.timer = timer
+}
+
+// terminal returns the connection to the terminal of the container, nil if
+// it did not start yet.
+func (c *containerInfo) terminal() io.ReadWriteCloser {
+	c.browserMu.Lock()
+	defer c.browserMu.Unlock()
+	return c.tty
+}
+
+// isRemoved returns whether the container of the session was removed.
+func (c *containerInfo) isRemoved() bool {
+	select {
+	case <-c.removed:
+		return true
+	default:
+		return false
+	}
+}
+
+// output sends output of the container to the browser, if there is one,
+// the spectators and the recording.
+func (c *containerInfo) output(out []byte) {
+	c.recording.output(out)
+
+	// the browser gets the output in the same order as the scrollback, so a
+	// browser resuming the session misses nothing
+	c.browserMu.Lock()
+	defer c.browserMu.Unlock()
+	c.screen.write(out)
+	c.spectators.output(out)
+	c.writeBrowser(message{
+		Type: "stdout",
+		Data: string(out),
+	})
+}
+
+// writeBrowser writes msg to the browser, if there is one. c.browserMu must
+// be held.
+func (c *containerInfo) writeBrowser(msg message) {
+	if c.browser == nil {
+		return
+	}
+	if err := c.browser.WriteJSON(msg); err != nil {
+		c.logger().Errorf("writing to browser websocket failed: %v", err)
+		return
+	}
+	c.logger().Debugf("wrote to browser websocket: %#v", msg)
+}
+
+// send writes msg to the browser of the session. It does nothing while the
+// browser is away.
+func (c *containerInfo) send(msg message) error {
+	c.browserMu.Lock()
+	conn := c.browser
+	c.browserMu.Unlock()
+	if conn == nil {
+		return nil
+	}
+	return conn.WriteJSON(msg)
+}
+
+// closeBrowser closes the websocket of the browser of the session with code
+// and reason.
+func (c *containerInfo) closeBrowser(code int, reason string) {
+	c.browserMu.Lock()
+	conn := c.browser
+	c.browser = nil
+	c.browserMu.Unlock()
+	if conn == nil {
+		return
+	}
+	if err := conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason)); err != nil && err != websocket.ErrCloseSent {
+		c.logger().Errorf("closing browser websocket failed: %v", err)
+	}
+	conn.Close()
+}
+
+// reattach makes conn the browser of a started session and sends it the
+// scrollback of its terminals. It returns the websocket of the browser it
+// replaces, if any.
+func (c *containerInfo) reattach(conn *lockedConn) (*lockedConn, error) {
+	c.browserMu.Lock()
+	defer c.browserMu.Unlock()
+	if c.tty == nil || c.isRemoved() {
+		return nil, errors.New("session is not running")
+	}
+	previous := c.browser
+	c.browser = conn
+	c.attachments++
+
+	// redraw the terminals as they are now
+	c.writeBrowser(message{
+		Type: "stdout",
+		Data: terminalReset + c.screen.String(),
+	})
+	for _, t := range c.terminals {
+		c.writeBrowser(message{Type: "terminal", Terminal: t.id})
+		c.writeBrowser(message{
+			Type:     "stdout",
+			Data:     t.scrollback.String(),
+			Terminal: t.id,
+		})
+	}
+	return previous, nil
+}
+
+// detach forgets conn as the browser of the session. It returns false if conn
+// is no longer its browser, and the number of browsers that attached so far.
+func (c *containerInfo) detach(conn *lockedConn) (int, bool) {
+	c.browserMu.Lock()
+	defer c.browserMu.Unlock()
+	if c.browser != conn {
+		return c.attachments, false
+	}
+	c.browser = nil
+	return c.attachments, true
+}
+
+// browserLeft is called when the browser websocket of a session is gone. The
+// container is removed unless the session started and a browser resumes it
+// within h.resumeGrace.
+func (h *handler) browserLeft(ctrInfo *containerInfo, conn *lockedConn) {
+	log := ctrInfo.logger()
+	attachments, ok := ctrInfo.detach(conn)
+	if !ok || ctrInfo.isRemoved() {
+		// the session was resumed elsewhere or has ended
+		return
+	}
+	if h.resumeGrace <= 0 || ctrInfo.terminal() == nil || h.isDraining() {
+		if err := h.removeContainer(ctrInfo); err != nil {
+			log.Errorf("removing container %s failed: %v", ctrInfo.containerid, err)
+		}
+		return
+	}
+
+	log.Infof("browser left, keeping the container for %s", h.resumeGrace)
+	time.AfterFunc(h.resumeGrace, func() {
+		ctrInfo.browserMu.Lock()
+		resumed := ctrInfo.browser != nil || ctrInfo.attachments != attachments
+		ctrInfo.browserMu.Unlock()
+		if resumed {
+			return
+		}
+		log.Info("session was not resumed in time")
+		if err := h.removeContainer(ctrInfo); err != nil {
+			log.Errorf("removing container %s failed: %v", ctrInfo.containerid, err)
+		}
+	})
+}
+
+// resumable returns the live session with the resume token, nil if there is
+// none.
+func (h *handler) resumable(token string) *containerInfo {
+	h.sessionsMu.Lock()
+	defer h.sessionsMu.Unlock()
+	for _, ctrInfo := range h.sessions {
+		if subtle.ConstantTimeCompare([]byte(ctrInfo.resumeToken), []byte(token)) == 1 {
+			return ctrInfo
+		}
+	}
+	return nil
+}
+
+// resumeSession attaches the browser websocket conn to the session with the
+// resume token, replacing its previous browser.
+func (h *handler) resumeSession(conn *lockedConn, token, researcher string) {
+	ctrInfo := h.resumable(token)
+	if ctrInfo == nil || ctrInfo.researcher != researcher || h.resumeGrace <= 0 {
+		rejectSession(conn, websocket.ClosePolicyViolation, "The session cannot be resumed, it has ended.")
+		return
+	}
+	log := ctrInfo.logger()
+
+	previous, err := ctrInfo.reattach(conn)
+	if err != nil {
+		log.Warnf("resuming session failed: %v", err)
+		rejectSession(conn, websocket.ClosePolicyViolation, "The session cannot be resumed, it has ended.")
+		return
+	}
+	if previous != nil {
+		// the server may not have noticed the previous websocket is gone
+		if err := previous.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "session resumed elsewhere")); err != nil {
+			log.Debugf("closing previous browser websocket failed: %v", err)
+		}
+		previous.Close()
+	}
+	log.Info("browser resumed the session")
+
+	stopReading := make(chan struct{})
+	defer close(stopReading)
+	h.serveBrowser(ctrInfo, conn, readBrowser(conn, stopReading, log))
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/sirupsen/logrus"
+)
+
+// drainPollInterval is how often shutdown checks whether all the sessions
+// have ended during the grace period.
+const drainPollInterval = 500 * time.Millisecond
+
+// isDraining returns whether the server is shutting down and must not start
+// new sessions.
+func (h *handler) isDraining() bool {
+	return atomic.LoadInt32(&h.draining) == 1
+}
+
+// liveSessions returns the live sessions.
+func (h *handler) liveSessions() []*containerInfo {
+	h.sessionsMu.Lock()
+	defer h.sessionsMu.Unlock()
+	sessions := make([]*containerInfo, 0, len(h.sessions))
+	for _, ctrInfo := range h.sessions {
+		sessions = append(sessions, ctrInfo)
+	}
+	return sessions
+}
+
+// shutdown stops accepting new sessions, tells the connected browsers the
+// server is going away, waits up to grace for the sessions to end and then
+// removes the containers of the remaining ones on both daemons.
+func (h *handler) shutdown(srv *http.Server, grace time.Duration) {
+	atomic.StoreInt32(&h.draining, 1)
+
+	// stop listening, hijacked websocket connections are not waited for
+	ctx, cancel := context.WithTimeout(context.Background(), grace)
+	defer cancel()
+	go func() {
+		if err := srv.Shutdown(ctx); err != nil && err != context.DeadlineExceeded {
+			logrus.Errorf("shutting down server failed: %v", err)
+		}
+	}()
+
+	for _, ctrInfo := range h.liveSessions() {
+		if err := ctrInfo.send(message{
+			Type: "shutdown",
+			Data: fmt.Sprintf("Server is shutting down, this session ends in %d seconds.", int(grace.Seconds())),
+		}); err != nil {
+			ctrInfo.logger().Errorf("writing shutdown message to browser websocket failed: %v", err)
+		}
+	}
+
+	deadline := time.Now().Add(grace)
+	for len(h.liveSessions()) > 0 && time.Now().Before(deadline) {
+		time.Sleep(drainPollInterval)
+	}
+
+	for _, ctrInfo := range h.liveSessions() {
+		if err := h.removeContainer(ctrInfo); err != nil {
+			ctrInfo.logger().Errorf("removing container %s failed: %v", ctrInfo.containerid, err)
+		}
+		ctrInfo.closeBrowser(websocket.CloseGoingAway, "server shutting down")
+	}
+	logrus.Info("all sessions removed, server stopped")
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/gorilla/websocket"
+	"github.com/sirupsen/logrus"
+)
+
+// spectatorBacklog is how many messages a spectator can fall behind before
+// it is disconnected, so a slow spectator never holds up the session.
+const spectatorBacklog = 256
+
+// spectators are the read-only websockets watching a session. Its methods
+// can be called from multiple goroutines, on nil spectators they do nothing.
+type spectators struct {
+	mu       sync.Mutex
+	height   uint
+	width    uint
+	watchers map[*spectator]struct{}
+	closed   bool
+}
+
+// spectator is a websocket watching a session. Messages are queued in out
+// and written by their own goroutine.
+type spectator struct {
+	conn *lockedConn
+	out  chan message
+	// closeCode is sent to the spectator once out is closed.
+	closeCode int
+}
+
+func newSpectators() *spectators {
+	return &spectators{
+		watchers: map[*spectator]struct{}{},
+	}
+}
+
+// output sends output of the container to the spectators.
+func (s *spectators) output(data []byte) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.broadcast(message{Type: "stdout", Data: string(data)})
+}
+
+// resize tells the spectators the new size of the terminal.
+func (s *spectators) resize(height, width uint) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.height, s.width = height, width
+	s.broadcast(message{Type: "resize", Height: height, Width: width})
+}
+
+// send sends msg about one of the terminals opened in the container to the
+// spectators.
+func (s *spectators) send(msg message) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.broadcast(msg)
+}
+
+// broadcast queues msg for every spectator, disconnecting the ones that
+// fell too far behind. s.mu must be held.
+func (s *spectators) broadcast(msg message) {
+	for sp := range s.watchers {
+		select {
+		case sp.out <- msg:
+		default:
+			s.remove(sp, websocket.CloseTryAgainLater)
+		}
+	}
+}
+
+// join adds conn as a spectator, sending it the size of the terminal first,
+// then backlog, the messages redrawing the screen and the terminals opened in
+// the container. It returns nil if the session has ended.
+func (s *spectators) join(conn *lockedConn, log *logrus.Entry, backlog []message) *spectator {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	sp := &spectator{
+		conn: conn,
+		out:  make(chan message, spectatorBacklog),
+	}
+	if s.height > 0 && s.width > 0 {
+		sp.out <- message{Type: "resize", Height: s.height, Width: s.width}
+	}
+	for _, msg := range backlog {
+		sp.out <- msg
+	}
+	s.watchers[sp] = struct{}{}
+	go sp.write(log)
+	return sp
+}
+
+// leave removes a spectator that went away.
+func (s *spectators) leave(sp *spectator) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.remove(sp, websocket.CloseNormalClosure)
+}
+
+// remove stops sending to sp and closes it with code. s.mu must be held.
+func (s *spectators) remove(sp *spectator, code int) {
+	if _, ok := s.watchers[sp]; !ok {
+		return
+	}
+	delete(s.watchers, sp)
+	sp.closeCode = code
+	close(sp.out)
+}
+
+// close disconnects all the spectators once the session has ended.
+func (s *spectators) close() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	for sp := range s.watchers {
+		s.remove(sp, websocket.CloseNormalClosure)
+	}
+}
+
+// watch adds conn as a spectator of the session. The latest output of the
+// container and the terminals opened in it, with their size and scrollback,
+// are sent to it under browserMu so none of their output is missed or sent
+// twice.
+func (c *containerInfo) watch(conn *lockedConn, log *logrus.Entry) *spectator {
+	c.browserMu.Lock()
+	defer c.browserMu.Unlock()
+	var backlog []message
+	if out := c.screen.String(); out != "" {
+		backlog = append(backlog, message{Type: "stdout", Data: out})
+	}
+	for _, t := range c.terminals {
+		backlog = append(backlog, message{Type: "terminal", Terminal: t.id})
+		if t.height > 0 && t.width > 0 {
+			backlog = append(backlog, message{Type: "resize", Height: t.height, Width: t.width, Terminal: t.id})
+		}
+		if out := t.scrollback.String(); out != "" {
+			backlog = append(backlog, message{Type: "stdout", Data: out, Terminal: t.id})
+		}
+	}
+	return c.spectators.join(conn, log, backlog)
+}
+
+// count returns the number of spectators.
+func (s *spectators) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.watchers)
+}
+
+// write sends the queued messages to the spectator and closes its websocket
+// once they are all sent.
+func (sp *spectator) write(log *logrus.Entry) {
+	failed := false
+	for msg := range sp.out {
+		if failed {
+			continue
+		}
+		if err := sp.conn.WriteJSON(msg); err != nil {
+			log.Errorf("writing to spectator websocket failed: %v", err)
+			failed = true
+		}
+	}
+	if sp.closeCode == websocket.CloseTryAgainLater {
+		log.Warn("spectator fell behind, disconnected it")
+	}
+	if err := sp.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(sp.closeCode, "")); err != nil && err != websocket.ErrCloseSent {
+		log.Debugf("closing spectator websocket failed: %v", err)
+	}
+	sp.conn.Close()
+}
+
+// session returns the live session with id, nil if there is none.
+func (h *handler) session(id string) *containerInfo {
+	h.sessionsMu.Lock()
+	defer h.sessionsMu.Unlock()
+	return h.sessions[id]
+}
+
+// spectateHandler lets reviewers and the researcher of a live session watch
+// its terminals. Spectators get the scrollback of the session when they join
+// and then its output, anything they send is ignored.
+func (h *handler) spectateHandler(w http.ResponseWriter, r *http.Request) {
+	wsConn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		logrus.Errorf("websocket upgrader failed: %v", err)
+		return
+	}
+	conn := &lockedConn{Conn: wsConn}
+
+	researcher, err := h.authenticate(r)
+	if err != nil {
+		logrus.Warnf("unauthenticated spectator from %s: %v", r.RemoteAddr, err)
+		rejectSession(conn, websocket.ClosePolicyViolation, fmt.Sprintf("Authentication failed: %v.", err))
+		return
+	}
+	// without authentication anyone knowing a session ID could get in
+	if researcher == "" {
+		rejectSession(conn, websocket.ClosePolicyViolation, "Sessions can only be watched with authentication enabled.")
+		return
+	}
+	id := r.URL.Query().Get("session")
+	log := logrus.WithFields(logrus.Fields{
+		"session":   id,
+		"spectator": researcher,
+	})
+
+	ctrInfo := h.session(id)
+	if ctrInfo == nil {
+		rejectSession(conn, websocket.ClosePolicyViolation, fmt.Sprintf("There is no live session %q.", id))
+		return
+	}
+	if !h.mayReview(researcher, ctrInfo.researcher) {
+		log.Warnf("watching a session of %q denied", ctrInfo.researcher)
+		rejectSession(conn, websocket.ClosePolicyViolation, "You may not watch this session.")
+		return
+	}
+
+	// the notice goes out before the scrollback
+	if err := conn.WriteJSON(message{
+		Type: "spectate",
+		Data: fmt.Sprintf("Watching session %s of profile %s, read-only.", id, ctrInfo.profile.Name),
+	}); err != nil {
+		log.Errorf("writing to spectator websocket failed: %v", err)
+	}
+	sp := ctrInfo.watch(conn, log)
+	if sp == nil {
+		rejectSession(conn, websocket.CloseNormalClosure, "The session has ended.")
+		return
+	}
+	log.Infof("spectator joined, %d watching", ctrInfo.spectators.count())
+
+	// drop whatever the spectator sends until it goes away
+	stop := make(chan struct{})
+	defer close(stop)
+	for data := range readBrowser(conn, stop, log) {
+		log.Debugf("ignoring %s message from spectator", data.Type)
+	}
+	ctrInfo.spectators.leave(sp)
+	log.Info("spectator left")
+}
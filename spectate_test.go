@@ -0,0 +1,104 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+// dialSpectator watches the session with id, with the extra query
+// parameters in query.
+func (s *testServer) dialSpectator(t *testing.T, id, query string) *websocket.Conn {
+	t.Helper()
+	u := "ws" + strings.TrimPrefix(s.URL, "http") + "/spectate?session=" + id + query
+	conn, _, err := websocket.DefaultDialer.Dial(u, nil)
+	if err != nil {
+		t.Fatalf("dialing %s: %v", u, err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestSpectate(t *testing.T) {
+	s := newTestServer(t, func(h *handler) {
+		h.tokenSecret = testSecret
+	})
+	conn := s.dial(t, "profile=default-docker&token="+testToken(t, "alice"))
+	ctr := waitForContainers(t, s.docker, 1)[0]
+	id := ctr.config.Labels[sessionLabel]
+
+	send(t, conn, message{Type: "resize", Height: 30, Width: 100})
+	send(t, conn, message{Type: "stdin", Data: "echo one\n"})
+	readOutput(t, conn, "echo one\n")
+
+	spectator := s.dialSpectator(t, id, "&token="+testToken(t, "alice"))
+	msg := readMessage(t, spectator, "spectate")
+	if !strings.Contains(msg.Data, "Watching session "+id) {
+		t.Errorf("unexpected spectate notice %q", msg.Data)
+	}
+	// the size and scrollback come first
+	msg = readMessage(t, spectator, "resize")
+	if msg.Height != 30 || msg.Width != 100 {
+		t.Errorf("expected the spectator to get size 100x30, got %dx%d", msg.Width, msg.Height)
+	}
+	readOutput(t, spectator, "echo one\n")
+
+	send(t, conn, message{Type: "stdin", Data: "echo two\n"})
+	readOutput(t, spectator, "echo two\n")
+
+	// spectators are read-only
+	send(t, spectator, message{Type: "stdin", Data: "echo evil\n"})
+	send(t, spectator, message{Type: "resize", Height: 10, Width: 10})
+	send(t, conn, message{Type: "stdin", Data: "echo three\n"})
+	if out := readOutput(t, conn, "echo three\n"); strings.Contains(out, "evil") {
+		t.Errorf("input of the spectator reached the container: %q", out)
+	}
+	if ctrs := s.docker.snapshot(); ctrs[0].height != 30 {
+		t.Errorf("the spectator resized the container to %dx%d", ctrs[0].width, ctrs[0].height)
+	}
+
+	closeSession(t, conn)
+	expectClose(t, spectator, websocket.CloseNormalClosure)
+}
+
+func TestSpectateAuth(t *testing.T) {
+	s := newTestServer(t, func(h *handler) {
+		h.tokenSecret = testSecret
+		h.reviewers = map[string]bool{"carol": true}
+	})
+	s.dial(t, "profile=default-docker&token="+testToken(t, "alice"))
+	id := waitForContainers(t, s.docker, 1)[0].config.Labels[sessionLabel]
+
+	for _, tc := range []struct {
+		id, query, rejection string
+	}{
+		{id, "", "missing access token"},
+		{id, "&token=" + testToken(t, "bob"), "You may not watch this session."},
+		{strings.Repeat("f", 32), "&token=" + testToken(t, "carol"), "There is no live session"},
+	} {
+		conn := s.dialSpectator(t, tc.id, tc.query)
+		msg := readMessage(t, conn, "rejected")
+		if !strings.Contains(msg.Data, tc.rejection) {
+			t.Errorf("%s: expected rejection %q, got %q", tc.query, tc.rejection, msg.Data)
+		}
+		expectClose(t, conn, websocket.ClosePolicyViolation)
+	}
+
+	for _, researcher := range []string{"alice", "carol"} {
+		conn := s.dialSpectator(t, id, "&token="+testToken(t, researcher))
+		readMessage(t, conn, "spectate")
+	}
+}
+
+func TestSpectateWithoutAuth(t *testing.T) {
+	s := newTestServer(t, nil)
+	s.dial(t, "profile=default-docker")
+	id := waitForContainers(t, s.docker, 1)[0].config.Labels[sessionLabel]
+
+	conn := s.dialSpectator(t, id, "")
+	if msg := readMessage(t, conn, "rejected"); !strings.Contains(msg.Data, "authentication enabled") {
+		t.Errorf("expected watching without authentication to be rejected, got %q", msg.Data)
+	}
+	expectClose(t, conn, websocket.ClosePolicyViolation)
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// maxTerminals is how many terminals a session can open in its container on
+// top of the terminal of the container itself.
+const maxTerminals = 8
+
+var errTooManyTerminals = fmt.Errorf("at most %d terminals can be open", maxTerminals)
+
+// terminal is a shell run in the container of a session with exec, next to
+// the terminal of the container itself.
+type terminal struct {
+	id     string
+	execID string
+	tty    io.ReadWriteCloser
+	// scrollback is sent to a browser resuming the session and to joining
+	// spectators with the size of the terminal. They are guarded by the
+	// browserMu of the session.
+	scrollback *ringBuffer
+	height     uint
+	width      uint
+}
+
+// addTerminal adds the exec execID attached to tty to the terminals of the
+// session, the spectators and the recording, and returns it. It takes the
+// place reserved with reserveTerminal.
+func (c *containerInfo) addTerminal(execID string, tty io.ReadWriteCloser) (*terminal, error) {
+	c.browserMu.Lock()
+	defer c.browserMu.Unlock()
+	c.openingTerminals--
+	if c.isRemoved() {
+		return nil, errors.New("session has ended")
+	}
+	c.nextTerminal++
+	t := &terminal{
+		id:         strconv.Itoa(c.nextTerminal),
+		execID:     execID,
+		tty:        tty,
+		scrollback: newRingBuffer(resumeBufferSize),
+	}
+	c.terminals = append(c.terminals, t)
+	c.recording.terminalOpened(t.id)
+	c.spectators.send(message{Type: "terminal", Terminal: t.id})
+	return t, nil
+}
+
+// reserveTerminal reserves a place for a terminal being opened, so terminals
+// opened at the same time cannot exceed maxTerminals. It returns an error if
+// the session cannot open another terminal.
+func (c *containerInfo) reserveTerminal() error {
+	c.browserMu.Lock()
+	defer c.browserMu.Unlock()
+	if len(c.terminals)+c.openingTerminals >= maxTerminals {
+		return errTooManyTerminals
+	}
+	c.openingTerminals++
+	return nil
+}
+
+// releaseTerminal gives up the place of a terminal that failed to open.
+func (c *containerInfo) releaseTerminal() {
+	c.browserMu.Lock()
+	defer c.browserMu.Unlock()
+	c.openingTerminals--
+}
+
+// findTerminal returns the terminal with id, nil if there is none.
+func (c *containerInfo) findTerminal(id string) *terminal {
+	c.browserMu.Lock()
+	defer c.browserMu.Unlock()
+	for _, t := range c.terminals {
+		if t.id == id {
+			return t
+		}
+	}
+	return nil
+}
+
+// removeTerminal removes t from the terminals of the session and tells the
+// browser, the spectators and the recording it closed.
+func (c *containerInfo) removeTerminal(t *terminal) {
+	c.browserMu.Lock()
+	defer c.browserMu.Unlock()
+	for i, other := range c.terminals {
+		if other == t {
+			c.terminals = append(c.terminals[:i], c.terminals[i+1:]...)
+			break
+		}
+	}
+	closed := message{
+		Type:     "closed",
+		Data:     fmt.Sprintf("Terminal %s closed.", t.id),
+		Terminal: t.id,
+	}
+	c.recording.terminalClosed(t.id)
+	c.spectators.send(closed)
+	c.writeBrowser(closed)
+}
+
+// closeTerminals closes the connections to all the terminals of the session.
+func (c *containerInfo) closeTerminals() {
+	c.browserMu.Lock()
+	terminals := append([]*terminal(nil), c.terminals...)
+	c.browserMu.Unlock()
+	for _, t := range terminals {
+		t.tty.Close()
+	}
+}
+
+// terminalOutput sends output of the terminal t to the browser, if there is
+// one, the spectators and the recording, and keeps it for a browser resuming
+// the session.
+func (c *containerInfo) terminalOutput(t *terminal, out []byte) {
+	c.recording.terminalOutput(t.id, out)
+
+	c.browserMu.Lock()
+	defer c.browserMu.Unlock()
+	t.scrollback.write(out)
+	msg := message{
+		Type:     "stdout",
+		Data:     string(out),
+		Terminal: t.id,
+	}
+	c.spectators.send(msg)
+	c.writeBrowser(msg)
+}
+
+// terminalResized records the new size of the terminal t and tells the
+// spectators.
+func (c *containerInfo) terminalResized(t *terminal, height, width uint) {
+	c.browserMu.Lock()
+	defer c.browserMu.Unlock()
+	t.height, t.width = height, width
+	c.recording.terminalResize(t.id, height, width)
+	c.spectators.send(message{Type: "resize", Height: height, Width: width, Terminal: t.id})
+}
+
+// openTerminal runs a shell in the container of a session as the user of its
+// profile and tells the browser the ID of its terminal with a terminal
+// message, or why it failed with a closed message. The shell is started in
+// its own goroutine, so a slow docker daemon does not hold up the other
+// messages of the browser.
+func (h *handler) openTerminal(ctrInfo *containerInfo, height, width uint) {
+	if err := ctrInfo.reserveTerminal(); err != nil {
+		h.terminalFailed(ctrInfo, err)
+		return
+	}
+	go h.startTerminal(ctrInfo, height, width)
+}
+
+// startTerminal runs the shell of a terminal reserved by openTerminal.
+func (h *handler) startTerminal(ctrInfo *containerInfo, height, width uint) {
+	log := ctrInfo.logger()
+	cfg := NewContainerConfig(withDockerUser(ctrInfo.profile))
+	b := h.backend(ctrInfo.userns)
+	execID, tty, err := b.Exec(context.Background(), ctrInfo.containerid, cfg.User, cfg.Cmd)
+	if err != nil {
+		ctrInfo.releaseTerminal()
+		h.terminalFailed(ctrInfo, err)
+		return
+	}
+	t, err := ctrInfo.addTerminal(execID, tty)
+	if err != nil {
+		tty.Close()
+		h.terminalFailed(ctrInfo, err)
+		return
+	}
+	log.Infof("opened terminal %s with exec %s", t.id, execID)
+
+	if err := ctrInfo.send(message{Type: "terminal", Terminal: t.id}); err != nil {
+		log.Errorf("writing terminal message to browser websocket failed: %v", err)
+	}
+	if height > 0 && width > 0 {
+		h.resizeTerminal(ctrInfo, t, height, width)
+	}
+	go h.relayTerminal(ctrInfo, t)
+}
+
+// terminalFailed tells the browser a terminal could not be opened.
+func (h *handler) terminalFailed(ctrInfo *containerInfo, err error) {
+	ctrInfo.logger().Errorf("opening terminal failed: %v", err)
+	if err := ctrInfo.send(message{
+		Type: "closed",
+		Data: fmt.Sprintf("Opening a terminal failed: %v.", err),
+	}); err != nil {
+		ctrInfo.logger().Errorf("writing closed message to browser websocket failed: %v", err)
+	}
+}
+
+// relayTerminal reads from the terminal t of a session and sends the output
+// to the browser. Once the output ends the terminal is removed.
+func (h *handler) relayTerminal(ctrInfo *containerInfo, t *terminal) {
+	log := ctrInfo.logger()
+	defer t.tty.Close()
+
+	buf := make([]byte, 32*1024)
+	var pending []byte
+	for {
+		n, err := t.tty.Read(buf)
+		if n > 0 {
+			// keep a multi-byte character split between reads for the next one
+			var out []byte
+			out, pending = splitUTF8(append(pending, buf[:n]...))
+			log.Debugf("received from terminal %s: %q", t.id, out)
+			ctrInfo.terminalOutput(t, out)
+		}
+		if err != nil {
+			if err != io.EOF && !ctrInfo.isRemoved() {
+				log.Errorf("reading from terminal %s failed: %v", t.id, err)
+			}
+			break
+		}
+	}
+
+	ctrInfo.removeTerminal(t)
+	log.Infof("terminal %s closed", t.id)
+}
+
+// resizeTerminal resizes the tty of the terminal t of a session.
+func (h *handler) resizeTerminal(ctrInfo *containerInfo, t *terminal, height, width uint) {
+	if err := h.backend(ctrInfo.userns).ExecResize(context.Background(), t.execID, height, width); err != nil {
+		ctrInfo.logger().Errorf("resize terminal %s to height -> %d, width: %d failed: %v", t.id, height, width, err)
+		return
+	}
+	ctrInfo.terminalResized(t, height, width)
+}
+
+// serveTerminal handles a message from the browser for one of the terminals
+// opened in the container of a session.
+func (h *handler) serveTerminal(ctrInfo *containerInfo, data message) {
+	log := ctrInfo.logger()
+	t := ctrInfo.findTerminal(data.Terminal)
+	if t == nil {
+		log.Warnf("got %s message for unknown terminal %q", data.Type, data.Terminal)
+		return
+	}
+	switch data.Type {
+	case "stdin":
+		ctrInfo.timer.touch()
+		if len(data.Data) > 0 {
+			// record the input before the output it causes
+			ctrInfo.recording.terminalInput(t.id, data.Data)
+			if _, err := t.tty.Write([]byte(data.Data)); err != nil {
+				log.Errorf("writing to terminal %s failed: %v", t.id, err)
+				t.tty.Close()
+				return
+			}
+			log.Debugf("wrote to terminal %s: %q", t.id, data.Data)
+		}
+	case "resize":
+		h.resizeTerminal(ctrInfo, t, data.Height, data.Width)
+	case "close":
+		// the shell gets a hangup, relayTerminal tells the browser once
+		// its output ends
+		t.tty.Close()
+	default:
+		log.Warnf("got unknown data type: %s", data.Type)
+	}
+}
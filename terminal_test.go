@@ -0,0 +1,190 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// readTerminalOutput reads the output of the terminal id until it contains
+// want and returns it, skipping the output of the other terminals.
+func readTerminalOutput(t *testing.T, conn *websocket.Conn, id, want string) string {
+	t.Helper()
+	var out string
+	for !strings.Contains(out, want) {
+		msg := readMessage(t, conn, "stdout")
+		if msg.Terminal == id {
+			out += msg.Data
+		}
+	}
+	return out
+}
+
+// openTerminal opens another terminal in the session and returns its ID.
+func openTerminal(t *testing.T, conn *websocket.Conn) string {
+	t.Helper()
+	send(t, conn, message{Type: "terminal", Height: 20, Width: 60})
+	msg := readMessage(t, conn, "terminal")
+	if msg.Terminal == "" {
+		t.Fatal("expected the ID of the terminal")
+	}
+	return msg.Terminal
+}
+
+func TestTerminals(t *testing.T) {
+	s := newTestServer(t, nil)
+	conn := s.dial(t, "profile=default-docker")
+	ctr := waitForContainers(t, s.docker, 1)[0]
+
+	first := openTerminal(t, conn)
+	second := openTerminal(t, conn)
+	if first == second {
+		t.Fatalf("expected different terminal IDs, got %s twice", first)
+	}
+	execs := s.docker.snapshot()[0].execs
+	if len(execs) != 2 {
+		t.Fatalf("expected 2 execs, got %d", len(execs))
+	}
+	for _, e := range execs {
+		if e.user != "nobody" || strings.Join(e.cmd, " ") != "sh" {
+			t.Errorf("expected sh as nobody, got %q as %q", e.cmd, e.user)
+		}
+		if e.height != 20 || e.width != 60 {
+			t.Errorf("expected exec %s to start at 60x20, got %dx%d", e.id, e.width, e.height)
+		}
+	}
+
+	// input goes to the terminal it is for
+	send(t, conn, message{Type: "stdin", Data: "nc -l 4444\n", Terminal: first})
+	readTerminalOutput(t, conn, first, "nc -l 4444\n")
+	send(t, conn, message{Type: "stdin", Data: "echo trigger\n", Terminal: second})
+	if out := readTerminalOutput(t, conn, second, "echo trigger\n"); strings.Contains(out, "nc") {
+		t.Errorf("output of terminal %s reached terminal %s: %q", first, second, out)
+	}
+	send(t, conn, message{Type: "stdin", Data: "echo main\n"})
+	readTerminalOutput(t, conn, "", "echo main\n")
+
+	// terminals resize on their own
+	send(t, conn, message{Type: "resize", Height: 30, Width: 90, Terminal: second})
+	waitFor(t, "terminal resize", func() bool {
+		execs := s.docker.snapshot()[0].execs
+		return execs[0].height == 20 && execs[1].height == 30 && execs[1].width == 90
+	})
+	if ctr := s.docker.snapshot()[0]; ctr.height != 0 {
+		t.Errorf("resizing a terminal resized the container to %dx%d", ctr.width, ctr.height)
+	}
+
+	// closing a terminal leaves the session running
+	send(t, conn, message{Type: "close", Terminal: first})
+	if msg := readMessage(t, conn, "closed"); msg.Terminal != first {
+		t.Errorf("expected terminal %s to close, got %q", first, msg.Terminal)
+	}
+	if err := s.docker.exitExec(execs[1].id); err != nil {
+		t.Fatal(err)
+	}
+	if msg := readMessage(t, conn, "closed"); msg.Terminal != second {
+		t.Errorf("expected terminal %s to close, got %q", second, msg.Terminal)
+	}
+	send(t, conn, message{Type: "stdin", Data: "echo still here\n"})
+	readTerminalOutput(t, conn, "", "echo still here\n")
+
+	// terminals end with the container
+	third := openTerminal(t, conn)
+	if err := s.docker.exit(ctr.id, 0); err != nil {
+		t.Fatal(err)
+	}
+	expectClose(t, conn, websocket.CloseNormalClosure)
+	waitForContainers(t, s.docker, 0)
+	waitFor(t, "terminal to close", func() bool {
+		ctrInfo := s.h.session(ctr.config.Labels[sessionLabel])
+		return ctrInfo == nil || ctrInfo.findTerminal(third) == nil
+	})
+}
+
+func TestTerminalsLimit(t *testing.T) {
+	s := newTestServer(t, nil)
+	conn := s.dial(t, "profile=default-docker")
+	waitForContainers(t, s.docker, 1)
+
+	for i := 0; i < maxTerminals; i++ {
+		openTerminal(t, conn)
+	}
+	send(t, conn, message{Type: "terminal"})
+	msg := readMessage(t, conn, "closed")
+	if msg.Terminal != "" || !strings.Contains(msg.Data, errTooManyTerminals.Error()) {
+		t.Errorf("expected opening too many terminals to fail, got %#v", msg)
+	}
+	if execs := s.docker.snapshot()[0].execs; len(execs) != maxTerminals {
+		t.Errorf("expected %d execs, got %d", maxTerminals, len(execs))
+	}
+}
+
+func TestTerminalsSlowExec(t *testing.T) {
+	s := newTestServer(t, nil)
+	s.docker.execWait = make(chan struct{})
+	conn := s.dial(t, "profile=default-docker")
+	waitForContainers(t, s.docker, 1)
+
+	// the container keeps getting input while the shell starts
+	send(t, conn, message{Type: "terminal"})
+	send(t, conn, message{Type: "stdin", Data: "ls\n"})
+	readOutput(t, conn, "ls")
+
+	close(s.docker.execWait)
+	if msg := readMessage(t, conn, "terminal"); msg.Terminal == "" {
+		t.Error("expected the ID of the terminal")
+	}
+}
+
+func TestTerminalsResume(t *testing.T) {
+	s := newTestServer(t, func(h *handler) {
+		h.resumeGrace = time.Minute
+	})
+	conn, token := startResumable(t, s, "profile=default-docker")
+	waitForContainers(t, s.docker, 1)
+
+	id := openTerminal(t, conn)
+	send(t, conn, message{Type: "stdin", Data: "echo listening\n", Terminal: id})
+	readTerminalOutput(t, conn, id, "echo listening\n")
+	conn.Close()
+
+	// the terminal and its scrollback come back with the session
+	resumed := s.dial(t, "resume="+token)
+	if msg := readMessage(t, resumed, "terminal"); msg.Terminal != id {
+		t.Errorf("expected terminal %s, got %q", id, msg.Terminal)
+	}
+	readTerminalOutput(t, resumed, id, "echo listening\n")
+	send(t, resumed, message{Type: "stdin", Data: "echo again\n", Terminal: id})
+	readTerminalOutput(t, resumed, id, "echo again\n")
+}
+
+func TestTerminalsSpectate(t *testing.T) {
+	s := newTestServer(t, func(h *handler) {
+		h.tokenSecret = testSecret
+	})
+	conn := s.dial(t, "profile=default-docker&token="+testToken(t, "alice"))
+	ctr := waitForContainers(t, s.docker, 1)[0]
+
+	id := openTerminal(t, conn)
+	send(t, conn, message{Type: "stdin", Data: "echo before\n", Terminal: id})
+	readTerminalOutput(t, conn, id, "echo before\n")
+
+	// a joining spectator gets the terminal with its size and scrollback
+	spectator := s.dialSpectator(t, ctr.config.Labels[sessionLabel], "&token="+testToken(t, "alice"))
+	if msg := readMessage(t, spectator, "terminal"); msg.Terminal != id {
+		t.Errorf("expected terminal %s, got %q", id, msg.Terminal)
+	}
+	if msg := readMessage(t, spectator, "resize"); msg.Terminal != id || msg.Height != 20 || msg.Width != 60 {
+		t.Errorf("expected terminal %s at 60x20, got %#v", id, msg)
+	}
+	readTerminalOutput(t, spectator, id, "echo before\n")
+
+	send(t, conn, message{Type: "stdin", Data: "echo after\n", Terminal: id})
+	readTerminalOutput(t, spectator, id, "echo after\n")
+	send(t, conn, message{Type: "close", Terminal: id})
+	if msg := readMessage(t, spectator, "closed"); msg.Terminal != id {
+		t.Errorf("expected terminal %s to close, got %q", id, msg.Terminal)
+	}
+}